@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	"github.com/pgaskin/kasa/transport/linkie"
+)
+
+// maxFrameSize is the maximum size of a TCP message before the stream is
+// assumed not to be linkie.
+const maxFrameSize = 1 << 20
+
+// maxSegments is the maximum number of buffered out-of-order TCP segments
+// before the stream is abandoned.
+const maxSegments = 1024
+
+// message is a decrypted message sent to or from a device.
+type message struct {
+	Time     time.Time
+	Protocol string // tcp or udp
+	Src      netip.AddrPort
+	Dst      netip.AddrPort
+	Request  bool // whether it was sent to the device
+	JSON     []byte
+}
+
+// decoder extracts linkie messages from packets.
+type decoder struct {
+	Port    uint16              // the device port
+	Message func(m message)     // called for each message
+	streams map[flowKey]*stream // tcp streams
+}
+
+type flowKey struct {
+	Src, Dst netip.AddrPort
+}
+
+type stream struct {
+	init bool
+	next uint32            // next expected sequence number
+	ooo  map[uint32][]byte // out-of-order segments
+	buf  []byte            // unparsed data
+	bad  bool              // whether the stream isn't linkie
+}
+
+// Packet decodes a captured packet.
+func (d *decoder) Packet(p packet) {
+	var (
+		b     = p.Data
+		proto uint16 // ethertype
+	)
+	switch p.LinkType {
+	case linkTypeEthernet:
+		if len(b) < 14 {
+			return
+		}
+		proto, b = binary.BigEndian.Uint16(b[12:14]), b[14:]
+		for proto == 0x8100 || proto == 0x88A8 { // vlan
+			if len(b) < 4 {
+				return
+			}
+			proto, b = binary.BigEndian.Uint16(b[2:4]), b[4:]
+		}
+	case linkTypeNull, linkTypeLoop:
+		if len(b) < 4 {
+			return
+		}
+		// the address family is in the host byte order of the capturing
+		// machine, but the values are all small, so check both
+		af := binary.LittleEndian.Uint32(b[0:4])
+		if af > 0xFFFF {
+			af = binary.BigEndian.Uint32(b[0:4])
+		}
+		switch af {
+		case 2:
+			proto = 0x0800
+		case 10, 24, 28, 30:
+			proto = 0x86DD
+		}
+		b = b[4:]
+	case linkTypeLinuxSLL:
+		if len(b) < 16 {
+			return
+		}
+		proto, b = binary.BigEndian.Uint16(b[14:16]), b[16:]
+	case linkTypeLinuxSLL2:
+		if len(b) < 20 {
+			return
+		}
+		proto, b = binary.BigEndian.Uint16(b[0:2]), b[20:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		if len(b) < 1 {
+			return
+		}
+		switch b[0] >> 4 {
+		case 4:
+			proto = 0x0800
+		case 6:
+			proto = 0x86DD
+		}
+	default:
+		return
+	}
+
+	var (
+		src, dst netip.Addr
+		next     byte
+	)
+	switch proto {
+	case 0x0800:
+		if len(b) < 20 || b[0]>>4 != 4 {
+			return
+		}
+		ihl := int(b[0]&0xF) * 4
+		total := int(binary.BigEndian.Uint16(b[2:4]))
+		if ihl < 20 || total < ihl || len(b) < ihl {
+			return
+		}
+		if frag := binary.BigEndian.Uint16(b[6:8]); frag&0x3FFF != 0 {
+			return // fragmented
+		}
+		if total < len(b) {
+			b = b[:total] // ethernet padding
+		}
+		src = netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]})
+		dst = netip.AddrFrom4([4]byte{b[16], b[17], b[18], b[19]})
+		next, b = b[9], b[ihl:]
+	case 0x86DD:
+		if len(b) < 40 || b[0]>>4 != 6 {
+			return
+		}
+		if n := 40 + int(binary.BigEndian.Uint16(b[4:6])); n < len(b) {
+			b = b[:n]
+		}
+		var a [16]byte
+		copy(a[:], b[8:24])
+		src = netip.AddrFrom16(a)
+		copy(a[:], b[24:40])
+		dst = netip.AddrFrom16(a)
+		next, b = b[6], b[40:]
+		for next == 0 || next == 43 || next == 60 { // hop-by-hop, routing, destination options
+			if len(b) < 8 || len(b) < (int(b[1])+1)*8 {
+				return
+			}
+			next, b = b[0], b[(int(b[1])+1)*8:]
+		}
+	default:
+		return
+	}
+
+	switch next {
+	case 6:
+		if len(b) < 20 {
+			return
+		}
+		off := int(b[12]>>4) * 4
+		if off < 20 || len(b) < off {
+			return
+		}
+		var (
+			sp    = binary.BigEndian.Uint16(b[0:2])
+			dp    = binary.BigEndian.Uint16(b[2:4])
+			seq   = binary.BigEndian.Uint32(b[4:8])
+			flags = b[13]
+		)
+		if sp != d.Port && dp != d.Port {
+			return
+		}
+		d.tcp(p.Time, netip.AddrPortFrom(src, sp), netip.AddrPortFrom(dst, dp), seq, flags, b[off:])
+	case 17:
+		if len(b) < 8 {
+			return
+		}
+		var (
+			sp = binary.BigEndian.Uint16(b[0:2])
+			dp = binary.BigEndian.Uint16(b[2:4])
+			n  = int(binary.BigEndian.Uint16(b[4:6]))
+		)
+		if sp != d.Port && dp != d.Port {
+			return
+		}
+		if n < 8 || n > len(b) {
+			return
+		}
+		d.Message(message{
+			Time:     p.Time,
+			Protocol: "udp",
+			Src:      netip.AddrPortFrom(src, sp),
+			Dst:      netip.AddrPortFrom(dst, dp),
+			Request:  dp == d.Port,
+			JSON:     linkie.Decrypt(b[8:n]),
+		})
+	}
+}
+
+func (d *decoder) tcp(t time.Time, src, dst netip.AddrPort, seq uint32, flags byte, payload []byte) {
+	const (
+		fin = 0x01
+		syn = 0x02
+		rst = 0x04
+	)
+
+	if d.streams == nil {
+		d.streams = map[flowKey]*stream{}
+	}
+	k := flowKey{src, dst}
+
+	if flags&(rst|syn) != 0 {
+		delete(d.streams, k)
+		if flags&rst != 0 {
+			return
+		}
+	}
+
+	s, ok := d.streams[k]
+	if !ok {
+		if len(payload) == 0 && flags&syn == 0 {
+			return
+		}
+		s = &stream{ooo: map[uint32][]byte{}}
+		d.streams[k] = s
+	}
+	if !s.init {
+		s.init, s.next = true, seq
+		if flags&syn != 0 {
+			s.next++
+		}
+	}
+	if s.bad {
+		return
+	}
+
+	if len(payload) != 0 {
+		if len(s.ooo) >= maxSegments {
+			s.bad, s.buf, s.ooo = true, nil, nil
+			return
+		}
+		s.ooo[seq] = append([]byte(nil), payload...)
+	}
+	for {
+		var progress bool
+		for sseq, seg := range s.ooo {
+			if off := int32(s.next - sseq); off >= 0 {
+				delete(s.ooo, sseq)
+				if int(off) < len(seg) {
+					s.buf = append(s.buf, seg[off:]...)
+					s.next += uint32(len(seg)) - uint32(off)
+					progress = true
+				}
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+
+	for len(s.buf) >= linkie.SizePrefixLen {
+		n := int(binary.BigEndian.Uint32(s.buf))
+		if n > maxFrameSize {
+			s.bad, s.buf, s.ooo = true, nil, nil
+			return
+		}
+		if len(s.buf) < linkie.SizePrefixLen+n {
+			break
+		}
+		d.Message(message{
+			Time:     t,
+			Protocol: "tcp",
+			Src:      src,
+			Dst:      dst,
+			Request:  dst.Port() == d.Port,
+			JSON:     linkie.Decrypt(s.buf[linkie.SizePrefixLen : linkie.SizePrefixLen+n]),
+		})
+		s.buf = s.buf[linkie.SizePrefixLen+n:]
+	}
+
+	if flags&fin != 0 && len(s.ooo) == 0 {
+		delete(d.streams, k)
+	}
+}
@@ -0,0 +1,200 @@
+// Command kasa-pcap decodes linkie traffic from a pcap or pcapng capture,
+// printing each request and response as JSON.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+	"github.com/pgaskin/kasa/transport/linkie"
+)
+
+var (
+	Port   = flag.Int("port", linkie.DevicePort, "device port")
+	Decode = flag.Bool("decode", false, "decode messages as smartbulb.SmartBulbCommand (unknown fields are omitted)")
+	UTC    = flag.Bool("utc", false, "show timestamps in UTC")
+	Help   = flag.Bool("help", false, "show this help text")
+)
+
+func main() {
+	flag.Parse()
+
+	if *Help || flag.NArg() != 1 || *Port <= 0 || *Port > 0xFFFF {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] capture.pcap|-\n\noptions:\n", os.Args[0])
+		flag.PrintDefaults()
+		if *Help {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+
+	var r io.Reader
+	if fn := flag.Arg(0); fn == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(fn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	p := &printer{
+		W:      os.Stdout,
+		Decode: *Decode,
+		UTC:    *UTC,
+	}
+	d := &decoder{
+		Port:    uint16(*Port),
+		Message: p.Message,
+	}
+	err := readPackets(r, func(pkt packet) error {
+		d.Packet(pkt)
+		return nil
+	})
+	p.Flush()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printer pairs requests with their responses and prints them.
+type printer struct {
+	W      io.Writer
+	Decode bool
+	UTC    bool
+
+	pending map[pairKey]*pendingRequest
+}
+
+// pairKey identifies the requests which a response could be for. For UDP, the
+// device is not included since requests may be broadcast.
+type pairKey struct {
+	Protocol string
+	Client   netip.AddrPort
+	Device   netip.AddrPort
+}
+
+type pendingRequest struct {
+	message
+	answered bool
+}
+
+func (p *printer) Message(m message) {
+	if p.pending == nil {
+		p.pending = map[pairKey]*pendingRequest{}
+	}
+
+	k := pairKey{Protocol: m.Protocol}
+	if m.Request {
+		k.Client, k.Device = m.Src, m.Dst
+	} else {
+		k.Client, k.Device = m.Dst, m.Src
+	}
+	if m.Protocol == "udp" {
+		k.Device = netip.AddrPort{}
+	}
+
+	if m.Request {
+		if r, ok := p.pending[k]; ok && !r.answered {
+			p.print(r.message, nil)
+		}
+		p.pending[k] = &pendingRequest{message: m}
+		return
+	}
+
+	r, ok := p.pending[k]
+	if !ok {
+		p.print(message{}, &m)
+		return
+	}
+	if r.answered {
+		p.print(message{}, &m) // e.g., additional replies to a broadcast
+	} else {
+		p.print(r.message, &m)
+	}
+	if m.Protocol == "udp" {
+		r.answered = true
+	} else {
+		delete(p.pending, k)
+	}
+}
+
+// Flush prints requests which didn't have a response.
+func (p *printer) Flush() {
+	var ms []message
+	for k, r := range p.pending {
+		if !r.answered {
+			ms = append(ms, r.message)
+		}
+		delete(p.pending, k)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Time.Before(ms[j].Time)
+	})
+	for _, m := range ms {
+		p.print(m, nil)
+	}
+}
+
+// print prints a request (if it isn't the zero value) and its response (if
+// non-nil).
+func (p *printer) print(req message, resp *message) {
+	if !req.Time.IsZero() {
+		p.printMessage(req, "request", "")
+	}
+	if resp != nil {
+		var extra string
+		if !req.Time.IsZero() {
+			extra = fmt.Sprintf(" (+%s)", resp.Time.Sub(req.Time).Round(time.Microsecond))
+		}
+		p.printMessage(*resp, "response", extra)
+	}
+	fmt.Fprintln(p.W)
+}
+
+func (p *printer) printMessage(m message, what, extra string) {
+	t := m.Time
+	if p.UTC {
+		t = t.UTC()
+	}
+	fmt.Fprintf(p.W, "%s %s %s > %s %s%s\n", t.Format("2006-01-02 15:04:05.000000"), m.Protocol, m.Src, m.Dst, what, extra)
+	fmt.Fprintf(p.W, "%s\n", p.format(m.JSON))
+}
+
+// format pretty-prints a message, or quotes it if it isn't valid JSON.
+func (p *printer) format(b []byte) string {
+	if !json.Valid(b) {
+		return fmt.Sprintf("invalid json: %q", b)
+	}
+	if p.Decode {
+		var cmd smartbulb.SmartBulbCommand
+		if err := json.Unmarshal(b, &cmd); err != nil {
+			return fmt.Sprintf("decode: %v\n%s", err, p.indent(b))
+		}
+		if buf, err := json.MarshalIndent(cmd, "", "  "); err == nil {
+			return string(buf)
+		}
+	}
+	return p.indent(b)
+}
+
+func (p *printer) indent(b []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return string(b)
+	}
+	return buf.String()
+}
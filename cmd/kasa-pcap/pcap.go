@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// Link types (https://www.tcpdump.org/linktypes.html).
+const (
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLoop      = 108
+	linkTypeLinuxSLL  = 113
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	linkTypeLinuxSLL2 = 276
+)
+
+type packet struct {
+	Time     time.Time
+	LinkType uint32
+	Data     []byte
+}
+
+// readPackets reads packets from a pcap or pcapng file, calling fn for each
+// one. The packet data is only valid until fn returns.
+func readPackets(r io.Reader, fn func(packet) error) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return fmt.Errorf("read magic: %w", err)
+	}
+	switch {
+	case magic[0] == 0x0A && magic[1] == 0x0D && magic[2] == 0x0D && magic[3] == 0x0A:
+		return readPcapng(br, fn)
+	default:
+		return readPcap(br, fn)
+	}
+}
+
+func readPcap(r io.Reader, fn func(packet) error) error {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("read pcap header: %w", err)
+	}
+
+	var (
+		bo   binary.ByteOrder
+		nano bool
+	)
+	switch m := binary.LittleEndian.Uint32(hdr[0:4]); m {
+	case 0xA1B2C3D4:
+		bo = binary.LittleEndian
+	case 0xA1B23C4D:
+		bo, nano = binary.LittleEndian, true
+	case 0xD4C3B2A1:
+		bo = binary.BigEndian
+	case 0x4D3CB2A1:
+		bo, nano = binary.BigEndian, true
+	default:
+		return fmt.Errorf("read pcap header: unknown magic %08x", m)
+	}
+	linkType := bo.Uint32(hdr[20:24]) & 0x0FFFFFFF
+
+	var (
+		rec [16]byte
+		buf []byte
+	)
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read pcap record: %w", err)
+		}
+		sec, frac, n := bo.Uint32(rec[0:4]), bo.Uint32(rec[4:8]), bo.Uint32(rec[8:12])
+		if n > 1<<26 {
+			return fmt.Errorf("read pcap record: invalid length %d", n)
+		}
+		if cap(buf) < int(n) {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return fmt.Errorf("read pcap record: %w", err)
+		}
+		if !nano {
+			frac *= 1000
+		}
+		if err := fn(packet{
+			Time:     time.Unix(int64(sec), int64(frac)),
+			LinkType: linkType,
+			Data:     buf,
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+type pcapngInterface struct {
+	LinkType uint32
+	TSResol  uint64 // units per second
+}
+
+func readPcapng(r io.Reader, fn func(packet) error) error {
+	var (
+		bo     binary.ByteOrder
+		ifaces []pcapngInterface
+		hdr    [8]byte
+		buf    []byte
+	)
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read pcapng block: %w", err)
+		}
+
+		typ := binary.LittleEndian.Uint32(hdr[0:4])
+		if typ == 0x0A0D0D0A {
+			// section header block: the byte-order magic follows the length
+			var bom [4]byte
+			if _, err := io.ReadFull(r, bom[:]); err != nil {
+				return fmt.Errorf("read pcapng section header: %w", err)
+			}
+			switch binary.LittleEndian.Uint32(bom[:]) {
+			case 0x1A2B3C4D:
+				bo = binary.LittleEndian
+			case 0x4D3C2B1A:
+				bo = binary.BigEndian
+			default:
+				return fmt.Errorf("read pcapng section header: invalid byte-order magic")
+			}
+			ifaces = ifaces[:0]
+			n := bo.Uint32(hdr[4:8])
+			if n < 28 || n%4 != 0 || n > 1<<26 {
+				return fmt.Errorf("read pcapng section header: invalid length %d", n)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(n)-12); err != nil {
+				return fmt.Errorf("read pcapng section header: %w", err)
+			}
+			continue
+		}
+		if bo == nil {
+			return errors.New("read pcapng block: missing section header")
+		}
+
+		typ = bo.Uint32(hdr[0:4])
+		n := bo.Uint32(hdr[4:8])
+		if n < 12 || n%4 != 0 || n > 1<<26 {
+			return fmt.Errorf("read pcapng block: invalid length %d", n)
+		}
+		if cap(buf) < int(n)-8 {
+			buf = make([]byte, n-8)
+		}
+		buf = buf[:n-8]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return fmt.Errorf("read pcapng block: %w", err)
+		}
+		body := buf[:len(buf)-4] // without the trailing length
+
+		switch typ {
+		case 0x00000001: // interface description block
+			if len(body) < 8 {
+				return errors.New("read pcapng interface: block too short")
+			}
+			iface := pcapngInterface{
+				LinkType: uint32(bo.Uint16(body[0:2])),
+				TSResol:  1e6,
+			}
+			for opts := body[8:]; len(opts) >= 4; {
+				code, l := bo.Uint16(opts[0:2]), int(bo.Uint16(opts[2:4]))
+				if code == 0 || len(opts) < 4+l {
+					break
+				}
+				if code == 9 && l >= 1 { // if_tsresol
+					if v := opts[4]; v&0x80 != 0 {
+						if v&0x7F < 64 {
+							iface.TSResol = 1 << (v & 0x7F)
+						}
+					} else if v < 20 {
+						iface.TSResol = 1
+						for i := byte(0); i < v; i++ {
+							iface.TSResol *= 10
+						}
+					}
+				}
+				opts = opts[4+(l+3)/4*4:]
+			}
+			ifaces = append(ifaces, iface)
+
+		case 0x00000006, 0x00000002: // enhanced packet block, obsolete packet block
+			if len(body) < 20 {
+				return errors.New("read pcapng packet: block too short")
+			}
+			var id uint32
+			if typ == 0x00000006 {
+				id = bo.Uint32(body[0:4])
+			} else {
+				id = uint32(bo.Uint16(body[0:2]))
+			}
+			if int(id) >= len(ifaces) {
+				return fmt.Errorf("read pcapng packet: unknown interface %d", id)
+			}
+			iface := ifaces[id]
+			ts := uint64(bo.Uint32(body[4:8]))<<32 | uint64(bo.Uint32(body[8:12]))
+			capLen := bo.Uint32(body[12:16])
+			if int(capLen) > len(body)-20 {
+				return fmt.Errorf("read pcapng packet: invalid captured length %d", capLen)
+			}
+			hi, lo := bits.Mul64(ts%iface.TSResol, 1e9)
+			ns, _ := bits.Div64(hi, lo, iface.TSResol)
+			if err := fn(packet{
+				Time:     time.Unix(int64(ts/iface.TSResol), int64(ns)),
+				LinkType: iface.LinkType,
+				Data:     body[20 : 20+capLen],
+			}); err != nil {
+				return err
+			}
+
+		case 0x00000003: // simple packet block
+			if len(body) < 4 || len(ifaces) == 0 {
+				return errors.New("read pcapng packet: invalid simple packet block")
+			}
+			l := bo.Uint32(body[0:4])
+			if int(l) > len(body)-4 {
+				l = uint32(len(body) - 4)
+			}
+			if err := fn(packet{
+				LinkType: ifaces[0].LinkType,
+				Data:     body[4 : 4+l],
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
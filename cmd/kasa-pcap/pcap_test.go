@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/transport/linkie"
+)
+
+func TestDecode(t *testing.T) {
+	var (
+		client = [4]byte{192, 168, 0, 2}
+		device = [4]byte{192, 168, 0, 10}
+		bcast  = [4]byte{192, 168, 0, 255}
+		start  = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	var req, resp bytes.Buffer
+	linkie.NewFrameWriter(&req).Write([]byte(`{"system":{"get_sysinfo":{}}}`))
+	linkie.NewFrameWriter(&resp).Write([]byte(`{"system":{"get_sysinfo":{"alias":"test","err_code":0}}}`))
+
+	pkts := [][]byte{
+		ipv4(client, device, 6, tcp(50000, 9999, 1000, 0x02, nil)),
+		ipv4(device, client, 6, tcp(9999, 50000, 5000, 0x12, nil)),
+		ipv4(client, device, 6, tcp(50000, 9999, 1001+10, 0x10, req.Bytes()[10:])), // out of order
+		ipv4(client, device, 6, tcp(50000, 9999, 1001, 0x10, req.Bytes()[:10])),
+		ipv4(client, device, 6, tcp(50000, 9999, 1001, 0x10, req.Bytes()[:10])), // retransmission
+		ipv4(device, client, 6, tcp(9999, 50000, 5001, 0x18, resp.Bytes())),
+		ipv4(client, device, 6, tcp(50000, 9999, 1001+uint32(req.Len()), 0x11, nil)),
+		ipv4(client, bcast, 17, udp(50001, 9999, linkie.Encrypt(linkie.DiscoveryRequest))),
+		ipv4(device, client, 17, udp(9999, 50001, linkie.Encrypt([]byte(`{"system":{"get_sysinfo":{"alias":"udp"}}}`)))),
+		ipv4(client, device, 17, udp(50002, 9999, linkie.Encrypt([]byte(`{"system":{"set_dev_alias":{"alias":"x"}}}`)))),
+	}
+
+	for _, format := range []string{"pcap", "pcapng"} {
+		var capture []byte
+		if format == "pcap" {
+			capture = pcapFile(start, pkts)
+		} else {
+			capture = pcapngFile(start, pkts)
+		}
+
+		var out strings.Builder
+		p := &printer{W: &out, UTC: true}
+		d := &decoder{Port: 9999, Message: p.Message}
+		if err := readPackets(bytes.NewReader(capture), func(pkt packet) error {
+			d.Packet(pkt)
+			return nil
+		}); err != nil {
+			t.Fatalf("%s: read: %v", format, err)
+		}
+		p.Flush()
+
+		for _, exp := range []string{
+			"2021-01-02 03:04:05.000003 tcp 192.168.0.2:50000 > 192.168.0.10:9999 request\n{\n  \"system\": {\n    \"get_sysinfo\": {}\n  }\n}\n",
+			"2021-01-02 03:04:05.000005 tcp 192.168.0.10:9999 > 192.168.0.2:50000 response (+2µs)\n",
+			"\"alias\": \"test\"",
+			"2021-01-02 03:04:05.000007 udp 192.168.0.2:50001 > 192.168.0.255:9999 request\n",
+			"2021-01-02 03:04:05.000008 udp 192.168.0.10:9999 > 192.168.0.2:50001 response (+1µs)\n",
+			"2021-01-02 03:04:05.000009 udp 192.168.0.2:50002 > 192.168.0.10:9999 request\n",
+		} {
+			if !strings.Contains(out.String(), exp) {
+				t.Errorf("%s: output does not contain %q:\n%s", format, exp, out.String())
+			}
+		}
+		if n := strings.Count(out.String(), " request"); n != 3 {
+			t.Errorf("%s: expected 3 requests, got %d:\n%s", format, n, out.String())
+		}
+	}
+}
+
+func pcapFile(start time.Time, pkts [][]byte) []byte {
+	var b []byte
+	b = appendUint32(binary.LittleEndian, b, 0xA1B2C3D4)
+	b = appendUint16(binary.LittleEndian, b, 2)
+	b = appendUint16(binary.LittleEndian, b, 4)
+	b = appendUint32(binary.LittleEndian, b, 0)
+	b = appendUint32(binary.LittleEndian, b, 0)
+	b = appendUint32(binary.LittleEndian, b, 65535)
+	b = appendUint32(binary.LittleEndian, b, linkTypeEthernet)
+	for i, pkt := range pkts {
+		pkt = ethernet(pkt)
+		t := start.Add(time.Microsecond * time.Duration(i))
+		b = appendUint32(binary.LittleEndian, b, uint32(t.Unix()))
+		b = appendUint32(binary.LittleEndian, b, uint32(t.Nanosecond()/1000))
+		b = appendUint32(binary.LittleEndian, b, uint32(len(pkt)))
+		b = appendUint32(binary.LittleEndian, b, uint32(len(pkt)))
+		b = append(b, pkt...)
+	}
+	return b
+}
+
+func pcapngFile(start time.Time, pkts [][]byte) []byte {
+	bo := binary.BigEndian
+	block := func(b []byte, typ uint32, body []byte) []byte {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		b = appendUint32(bo, b, typ)
+		b = appendUint32(bo, b, uint32(12+len(body)))
+		b = append(b, body...)
+		b = appendUint32(bo, b, uint32(12+len(body)))
+		return b
+	}
+
+	var b, body []byte
+	body = appendUint32(bo, body[:0], 0x1A2B3C4D)
+	body = appendUint16(bo, body, 1)
+	body = appendUint16(bo, body, 0)
+	body = appendUint64(bo, body, ^uint64(0))
+	b = block(b, 0x0A0D0D0A, body)
+
+	body = appendUint16(bo, nil, linkTypeRaw)
+	body = appendUint16(bo, body, 0)
+	body = appendUint32(bo, body, 0)
+	body = append(appendUint16(bo, appendUint16(bo, body, 9), 1), 9, 0, 0, 0) // if_tsresol = 9 (ns)
+	body = appendUint32(bo, body, 0)                                          // opt_endofopt
+	b = block(b, 0x00000001, body)
+
+	for i, pkt := range pkts {
+		ts := uint64(start.Add(time.Microsecond * time.Duration(i)).UnixNano())
+		body = appendUint32(bo, nil, 0)
+		body = appendUint32(bo, body, uint32(ts>>32))
+		body = appendUint32(bo, body, uint32(ts))
+		body = appendUint32(bo, body, uint32(len(pkt)))
+		body = appendUint32(bo, body, uint32(len(pkt)))
+		body = append(body, pkt...)
+		b = block(b, 0x00000006, body)
+	}
+	return b
+}
+
+func ethernet(payload []byte) []byte {
+	b := make([]byte, 12, 14+len(payload))
+	b = appendUint16(binary.BigEndian, b, 0x0800)
+	return append(b, payload...)
+}
+
+func ipv4(src, dst [4]byte, proto byte, payload []byte) []byte {
+	b := make([]byte, 20, 20+len(payload))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:4], uint16(20+len(payload)))
+	b[8] = 64
+	b[9] = proto
+	copy(b[12:16], src[:])
+	copy(b[16:20], dst[:])
+	return append(b, payload...)
+}
+
+// tcp returns a tcp segment.
+func tcp(sp, dp uint16, seq uint32, flags byte, payload []byte) []byte {
+	b := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(b[0:2], sp)
+	binary.BigEndian.PutUint16(b[2:4], dp)
+	binary.BigEndian.PutUint32(b[4:8], seq)
+	b[12] = 5 << 4
+	b[13] = flags
+	return append(b, payload...)
+}
+
+// udp returns a udp datagram.
+func udp(sp, dp uint16, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(b[0:2], sp)
+	binary.BigEndian.PutUint16(b[2:4], dp)
+	binary.BigEndian.PutUint16(b[4:6], uint16(8+len(payload)))
+	return append(b, payload...)
+}
+
+func appendUint16(bo binary.ByteOrder, b []byte, v uint16) []byte {
+	var x [2]byte
+	bo.PutUint16(x[:], v)
+	return append(b, x[:]...)
+}
+
+func appendUint32(bo binary.ByteOrder, b []byte, v uint32) []byte {
+	var x [4]byte
+	bo.PutUint32(x[:], v)
+	return append(b, x[:]...)
+}
+
+func appendUint64(bo binary.ByteOrder, b []byte, v uint64) []byte {
+	var x [8]byte
+	bo.PutUint64(x[:], v)
+	return append(b, x[:]...)
+}
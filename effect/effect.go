@@ -0,0 +1,99 @@
+// Package effect applies, reads, and clears lighting effects on TP-Link light
+// strips (e.g., KL400, KL420, KL430).
+package effect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/lightstrip"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+	"github.com/pgaskin/kasa/transport"
+)
+
+// Apply enables an effect. See lightstrip.Preset for the built-in ones.
+func Apply(ctx context.Context, r transport.Requester, e lightstrip.Effect) error {
+	e.Enable = tpcommand.IntPtr(1)
+	return set(ctx, r, e)
+}
+
+// ApplyPreset enables a built-in effect by name.
+func ApplyPreset(ctx context.Context, r transport.Requester, name string) error {
+	e, ok := lightstrip.Preset(name)
+	if !ok {
+		return fmt.Errorf("unknown preset %q", name)
+	}
+	return Apply(ctx, r, e)
+}
+
+// Read gets the state of the current effect, if any.
+func Read(ctx context.Context, r transport.Requester) (smartbulb.LightingEffectState, error) {
+	var resp lightstrip.LightStripCommand
+	if err := transport.RequestContext(ctx, r, lightstrip.LightStripCommand{
+		SmartBulbCommand: smartbulb.SmartBulbCommand{
+			SysInfo: &smartbulb.SysInfoModule{
+				GetSysInfo: &smartbulb.GetSysInfoMethod{},
+			},
+		},
+	}, &resp); err != nil {
+		return smartbulb.LightingEffectState{}, err
+	}
+	if resp.SysInfo == nil {
+		return smartbulb.LightingEffectState{}, errors.New("missing sysinfo")
+	}
+	if err := resp.SysInfo.CheckError(); err != nil {
+		return smartbulb.LightingEffectState{}, err
+	}
+	if resp.SysInfo.GetSysInfo == nil {
+		return smartbulb.LightingEffectState{}, errors.New("missing sysinfo")
+	}
+	if err := resp.SysInfo.GetSysInfo.CheckError(); err != nil {
+		return smartbulb.LightingEffectState{}, err
+	}
+	if resp.SysInfo.GetSysInfo.LightingEffectState == nil {
+		return smartbulb.LightingEffectState{}, errors.New("device does not support lighting effects")
+	}
+	return *resp.SysInfo.GetSysInfo.LightingEffectState, nil
+}
+
+// Clear disables the current effect, if any.
+func Clear(ctx context.Context, r transport.Requester) error {
+	s, err := Read(ctx, r)
+	if err != nil {
+		return err
+	}
+	if s.Enable == nil || *s.Enable == 0 {
+		return nil
+	}
+	return set(ctx, r, lightstrip.Effect{
+		Custom: s.Custom,
+		Enable: tpcommand.IntPtr(0),
+		ID:     s.ID,
+		Name:   s.Name,
+	})
+}
+
+func set(ctx context.Context, r transport.Requester, e lightstrip.Effect) error {
+	var resp lightstrip.LightStripCommand
+	if err := transport.RequestContext(ctx, r, lightstrip.LightStripCommand{
+		LightingEffect: &lightstrip.LightingEffectModule{
+			SetLightingEffect: &lightstrip.SetLightingEffectMethod{
+				Effect: e,
+			},
+		},
+	}, &resp); err != nil {
+		return err
+	}
+	if resp.LightingEffect == nil {
+		return errors.New("missing lighting effect response")
+	}
+	if err := resp.LightingEffect.CheckError(); err != nil {
+		return err
+	}
+	if resp.LightingEffect.SetLightingEffect == nil {
+		return errors.New("missing lighting effect response")
+	}
+	return resp.LightingEffect.SetLightingEffect.CheckError()
+}
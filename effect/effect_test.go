@@ -0,0 +1,85 @@
+package effect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/pgaskin/kasa/tpcommand/lightstrip"
+)
+
+// stripRequester is a fake light strip which tracks the current effect.
+type stripRequester struct {
+	Effect *lightstrip.Effect
+	Sets   int
+}
+
+func (s *stripRequester) Request(in, out interface{}) error {
+	buf, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var req lightstrip.LightStripCommand
+	if err := json.Unmarshal(buf, &req); err != nil {
+		return err
+	}
+
+	var resp string
+	switch {
+	case req.LightingEffect != nil && req.LightingEffect.SetLightingEffect != nil:
+		e := req.LightingEffect.SetLightingEffect.Effect
+		if e.Enable == nil || e.ID == nil {
+			resp = `{"smartlife.iot.lighting_effect":{"set_lighting_effect":{"err_code":-3,"err_msg":"invalid argument"}}}`
+		} else {
+			s.Effect, s.Sets = &e, s.Sets+1
+			resp = `{"smartlife.iot.lighting_effect":{"set_lighting_effect":{"err_code":0}}}`
+		}
+	case req.SysInfo != nil && req.SysInfo.GetSysInfo != nil:
+		state := `{"enable":0,"name":"","id":"","custom":0,"brightness":100}`
+		if s.Effect != nil {
+			state = fmt.Sprintf(`{"enable":%d,"name":%q,"id":%q,"custom":%d,"brightness":100}`, *s.Effect.Enable, *s.Effect.Name, *s.Effect.ID, *s.Effect.Custom)
+		}
+		resp = `{"system":{"get_sysinfo":{"model":"KL430(US)","length":16,"lighting_effect_state":` + state + `,"err_code":0}}}`
+	default:
+		return fmt.Errorf("unexpected request %s", buf)
+	}
+	if out != nil {
+		return json.Unmarshal([]byte(resp), out)
+	}
+	return nil
+}
+
+func TestEffect(t *testing.T) {
+	ctx := context.Background()
+	s := &stripRequester{}
+
+	if err := ApplyPreset(ctx, s, "Aurora"); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if err := ApplyPreset(ctx, s, "Nonexistent"); err == nil {
+		t.Errorf("expected error for unknown preset")
+	}
+
+	st, err := Read(ctx, s)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if *st.Enable != 1 || *st.Name != "Aurora" || *st.ID != "xqUxDhbAhNLqulcuRMyPBmVGyTOyEMEu" {
+		t.Errorf("incorrect effect state %#v", st)
+	}
+
+	if err := Clear(ctx, s); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if st, err := Read(ctx, s); err != nil || *st.Enable != 0 || *st.Name != "Aurora" {
+		t.Errorf("expected effect to be disabled, got %#v (err: %v)", st, err)
+	}
+	if err := Clear(ctx, s); err != nil || s.Sets != 2 {
+		t.Errorf("expected clearing a disabled effect to be a no-op, got %d sets (err: %v)", s.Sets, err)
+	}
+
+	if err := Apply(ctx, s, lightstrip.Effect{}); err == nil {
+		t.Errorf("expected api error for invalid effect")
+	}
+}
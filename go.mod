@@ -1,3 +1,3 @@
 module github.com/pgaskin/kasa
 
-go 1.16
+go 1.18
@@ -0,0 +1,22 @@
+// Package expiry calculates client-side session expiry times.
+package expiry
+
+import "time"
+
+// Time returns the expiry time for a session with the specified timeout. It
+// expires a bit early so we don't race the device, but by no more than half
+// the timeout.
+func Time(timeout time.Duration) time.Time {
+	return time.Now().Add(timeout - margin(timeout))
+}
+
+func margin(timeout time.Duration) time.Duration {
+	m := time.Minute
+	if timeout/2 < m {
+		m = timeout / 2
+	}
+	if m < 0 {
+		m = 0
+	}
+	return m
+}
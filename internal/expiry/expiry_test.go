@@ -0,0 +1,23 @@
+package expiry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMargin(t *testing.T) {
+	for _, tc := range []struct {
+		Timeout time.Duration
+		Margin  time.Duration
+	}{
+		{time.Hour * 24, time.Minute},
+		{time.Minute * 2, time.Minute},
+		{time.Second * 30, time.Second * 15},
+		{0, 0},
+		{-time.Second, 0},
+	} {
+		if m := margin(tc.Timeout); m != tc.Margin {
+			t.Errorf("%s: expected margin %s, got %s", tc.Timeout, tc.Margin, m)
+		}
+	}
+}
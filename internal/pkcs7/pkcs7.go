@@ -0,0 +1,29 @@
+// Package pkcs7 implements PKCS#7 padding for block ciphers.
+package pkcs7
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrInvalidPadding is returned by Unpad if the padding is invalid.
+var ErrInvalidPadding = errors.New("invalid padding")
+
+// Pad returns a copy of b padded to a multiple of size, which must be between
+// 1 and 255.
+func Pad(b []byte, size int) []byte {
+	n := size - len(b)%size
+	return append(append(make([]byte, 0, len(b)+n), b...), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+// Unpad removes the padding from b, which must be a non-empty multiple of size.
+func Unpad(b []byte, size int) ([]byte, error) {
+	if len(b) == 0 || len(b)%size != 0 {
+		return nil, ErrInvalidPadding
+	}
+	n := int(b[len(b)-1])
+	if n == 0 || n > size || !bytes.Equal(b[len(b)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrInvalidPadding
+	}
+	return b[:len(b)-n], nil
+}
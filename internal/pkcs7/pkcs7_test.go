@@ -0,0 +1,43 @@
+package pkcs7
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPKCS7(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Data   string
+		Padded string
+	}{
+		{"Empty", "", strings.Repeat("\x08", 8)},
+		{"Short", "abc", "abc\x05\x05\x05\x05\x05"},
+		{"Block", "abcdefgh", "abcdefgh" + strings.Repeat("\x08", 8)},
+		{"Long", "abcdefghijk", "abcdefghijk\x05\x05\x05\x05\x05"},
+	} {
+		if b := Pad([]byte(tc.Data), 8); !bytes.Equal(b, []byte(tc.Padded)) {
+			t.Errorf("%s: pad: expected %q, got %q", tc.Name, tc.Padded, b)
+		}
+		if b, err := Unpad([]byte(tc.Padded), 8); err != nil {
+			t.Errorf("%s: unpad: %v", tc.Name, err)
+		} else if string(b) != tc.Data {
+			t.Errorf("%s: unpad: expected %q, got %q", tc.Name, tc.Data, b)
+		}
+	}
+	for _, tc := range []struct {
+		Name   string
+		Padded string
+	}{
+		{"Empty", ""},
+		{"NotMultiple", "abc\x05\x05\x05\x05"},
+		{"Zero", "abcdefg\x00"},
+		{"TooLarge", "abcdefg\x09"},
+		{"Inconsistent", "abcd\x04\x04\x03\x04"},
+	} {
+		if _, err := Unpad([]byte(tc.Padded), 8); err != ErrInvalidPadding {
+			t.Errorf("%s: expected invalid padding error, got %v", tc.Name, err)
+		}
+	}
+}
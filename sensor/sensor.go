@@ -0,0 +1,169 @@
+// Package sensor polls the motion and ambient light sensors of TP-Link
+// switches (e.g., KS220M).
+package sensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pgaskin/kasa/tpcommand/ks220m"
+	"github.com/pgaskin/kasa/tpcommand/las"
+	"github.com/pgaskin/kasa/tpcommand/pir"
+	"github.com/pgaskin/kasa/transport"
+)
+
+var DefaultInterval = time.Second * 5
+
+// Motion is the motion trigger configuration.
+type Motion struct {
+	Enabled   bool
+	Range     int           // far (0), mid (1), near (2), custom (3)
+	Threshold int           // sensitivity threshold for Range
+	ColdTime  time.Duration // time without motion before the switch turns off
+}
+
+// Light is the ambient light configuration and reading. Brightness and the
+// level values are the raw readings from the device, which are a percent of
+// the sensor range (0-100), not lux.
+type Light struct {
+	Enabled    bool
+	Brightness int     // current ambient brightness (get_current_brt)
+	DarkIndex  int     // index into Levels of the threshold below which motion turns on the switch
+	Levels     []Level // configured thresholds
+}
+
+// Level is an ambient light threshold.
+type Level struct {
+	Name  string
+	Value int // percent
+}
+
+// Reading is the state of the sensors at a point in time.
+type Reading struct {
+	Time   time.Time
+	Motion Motion
+	Light  Light
+}
+
+// IsDark returns true if the current brightness is at or below the configured
+// dark threshold.
+func (l Light) IsDark() bool {
+	if l.DarkIndex < 0 || l.DarkIndex >= len(l.Levels) {
+		return false
+	}
+	return l.Brightness <= l.Levels[l.DarkIndex].Value
+}
+
+// Poller reads the sensors of a device.
+type Poller struct {
+	Requester transport.Requester
+	Interval  time.Duration // time between readings (if zero, DefaultInterval is used)
+}
+
+// Read gets the current sensor configuration and readings.
+func (p *Poller) Read(ctx context.Context) (Reading, error) {
+	var resp ks220m.KS220MCommand
+	if err := transport.RequestContext(ctx, p.Requester, ks220m.KS220MCommand{
+		LAS: &las.LASModule{
+			GetConfig:     &las.GetConfigMethod{},
+			GetCurrentBrt: &las.GetCurrentBrtMethod{},
+		},
+		PIR: &pir.PIRModule{
+			GetConfig: &pir.GetConfigMethod{},
+		},
+	}, &resp); err != nil {
+		return Reading{}, err
+	}
+	r := Reading{Time: time.Now()}
+
+	if resp.PIR == nil {
+		return r, errors.New("missing motion sensor")
+	}
+	if err := resp.PIR.CheckError(); err != nil {
+		return r, fmt.Errorf("motion sensor: %w", err)
+	}
+	if resp.PIR.GetConfig == nil {
+		return r, errors.New("missing motion sensor config")
+	}
+	if err := resp.PIR.GetConfig.CheckError(); err != nil {
+		return r, fmt.Errorf("motion sensor config: %w", err)
+	}
+	pc := resp.PIR.GetConfig
+	r.Motion.Enabled = intOr(pc.Enable) != 0
+	r.Motion.Range = intOr(pc.TriggerIndex)
+	r.Motion.ColdTime = time.Duration(intOr(pc.ColdTime)) * time.Millisecond
+	if pc.Array != nil && r.Motion.Range >= 0 && r.Motion.Range < len(*pc.Array) {
+		r.Motion.Threshold = (*pc.Array)[r.Motion.Range]
+	}
+
+	if resp.LAS == nil {
+		return r, errors.New("missing ambient light sensor")
+	}
+	if err := resp.LAS.CheckError(); err != nil {
+		return r, fmt.Errorf("ambient light sensor: %w", err)
+	}
+	if resp.LAS.GetConfig == nil || resp.LAS.GetCurrentBrt == nil {
+		return r, errors.New("missing ambient light sensor config")
+	}
+	if err := resp.LAS.GetConfig.CheckError(); err != nil {
+		return r, fmt.Errorf("ambient light sensor config: %w", err)
+	}
+	if err := resp.LAS.GetCurrentBrt.CheckError(); err != nil {
+		return r, fmt.Errorf("ambient light sensor brightness: %w", err)
+	}
+	r.Light.Brightness = intOr(resp.LAS.GetCurrentBrt.Value)
+	if lc := resp.LAS.GetConfig; lc.Devs != nil && len(*lc.Devs) != 0 {
+		d := (*lc.Devs)[0]
+		r.Light.Enabled = intOr(d.Enable) != 0
+		r.Light.DarkIndex = intOr(d.DarkIndex)
+		if d.LevelArray != nil {
+			for _, l := range *d.LevelArray {
+				var n string
+				if l.Name != nil {
+					n = *l.Name
+				}
+				r.Light.Levels = append(r.Light.Levels, Level{
+					Name:  n,
+					Value: intOr(l.Value),
+				})
+			}
+		}
+	}
+	return r, nil
+}
+
+// Poll calls fn with a reading immediately, then every Interval until ctx is
+// cancelled, returning the context error. Failed readings are passed to fn
+// rather than stopping polling.
+func (p *Poller) Poll(ctx context.Context, fn func(r Reading, err error)) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		r, err := p.Read(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fn(r, err)
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func intOr(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,65 @@
+package sensor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/tpcommand"
+)
+
+type staticRequester string
+
+func (s staticRequester) Request(in, out interface{}) error {
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), out)
+}
+
+// KS220M(US) 1.0, firmware 1.0.10 (trimmed)
+const ks220mResponse = `{"smartlife.iot.PIR":{"get_config":{"ver":"1.0","trigger_index":1,"cold_time":60000,"enable":1,"version":"1.0","max_adc":4095,"min_adc":0,"array":[80,50,20,61],"err_code":0}},"smartlife.iot.LAS":{"get_config":{"ver":"1.0","devs":[{"hw_id":0,"enable":1,"dark_index":1,"min_adc":0,"max_adc":2450,"level_array":[{"name":"cloudy","adc":490,"value":20},{"name":"overcast","adc":294,"value":12},{"name":"dawn","adc":222,"value":9},{"name":"twilight","adc":222,"value":9},{"name":"total darkness","adc":111,"value":4},{"name":"custom","adc":2400,"value":97}]}],"err_code":0},"get_current_brt":{"value":10,"err_code":0}}}`
+
+func TestRead(t *testing.T) {
+	r, err := (&Poller{Requester: staticRequester(ks220mResponse)}).Read(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m := r.Motion; !m.Enabled || m.Range != 1 || m.Threshold != 50 || m.ColdTime != time.Minute {
+		t.Errorf("incorrect motion config %+v", m)
+	}
+	if l := r.Light; !l.Enabled || l.Brightness != 10 || l.DarkIndex != 1 || len(l.Levels) != 6 || l.Levels[1].Name != "overcast" || !l.IsDark() {
+		t.Errorf("incorrect light reading %+v", l)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	_, err := (&Poller{Requester: staticRequester(`{"smartlife.iot.PIR":{"err_code":-1,"err_msg":"module not support"},"smartlife.iot.LAS":{"err_code":-1,"err_msg":"module not support"}}`)}).Read(context.Background())
+	var terr tpcommand.Error
+	if !errors.As(err, &terr) || terr.Code != -1 {
+		t.Errorf("expected module not supported error, got %v", err)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var n int
+	err := (&Poller{Requester: staticRequester(ks220mResponse), Interval: time.Millisecond}).Poll(ctx, func(r Reading, err error) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if n++; n == 3 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("expected context cancelled, got %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 readings, got %d", n)
+	}
+}
@@ -0,0 +1,715 @@
+package sim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/device"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+	"github.com/pgaskin/kasa/transport"
+)
+
+// Bulb is a simulated smart bulb. It implements transport.Handler so it can be
+// used with a server, and transport.Requester so it can be used directly.
+//
+// Transitions are applied immediately.
+type Bulb struct {
+	Profile  Profile
+	DeviceID string
+	HwID     string
+	OemID    string
+	MAC      string
+	RSSI     int
+	Now      func() time.Time // if nil, time.Now is used
+
+	mu          sync.Mutex
+	methods     map[string]map[string]method
+	alias       string
+	state       smartbulb.LightState // current state (OnOff is always set)
+	dftOnState  smartbulb.LightState // state to restore when turned on
+	preferred   []smartbulb.PreferredState
+	hardOn      smartbulb.PreferredState
+	softOn      smartbulb.PreferredState
+	rules       []smartbulb.Rule
+	rulesEnable int
+	tzIndex     int
+	timeOffset  time.Duration
+	energy      map[[3]int]float64 // Wh by year, month, day
+	energyAt    time.Time
+}
+
+var (
+	_ transport.Handler   = (*Bulb)(nil)
+	_ transport.Requester = (*Bulb)(nil)
+)
+
+// NewBulb creates a new simulated bulb which is turned on at full brightness.
+func NewBulb(p Profile) *Bulb {
+	b := &Bulb{
+		Profile:  p,
+		DeviceID: randomHex(20),
+		HwID:     randomHex(16),
+		OemID:    randomHex(16),
+		MAC:      randomMAC(),
+		RSSI:     -50,
+		alias:    p.Model,
+		state: smartbulb.LightState{
+			OnOff:      tpcommand.IntPtr(1),
+			Mode:       tpcommand.StrPtr("normal"),
+			Hue:        tpcommand.IntPtr(0),
+			Saturation: tpcommand.IntPtr(0),
+			ColorTemp:  tpcommand.IntPtr(0),
+			Brightness: tpcommand.IntPtr(100),
+		},
+		hardOn: smartbulb.PreferredState{
+			LightState: smartbulb.LightState{Mode: tpcommand.StrPtr("last_status")},
+		},
+		softOn: smartbulb.PreferredState{
+			LightState: smartbulb.LightState{Mode: tpcommand.StrPtr("last_status")},
+		},
+		rulesEnable: 1,
+		energy:      map[[3]int]float64{},
+	}
+	if min, _, ok := p.TemperatureRange(); ok {
+		b.state.ColorTemp = tpcommand.IntPtr(min)
+	}
+	b.dftOnState = copyLightState(b.state)
+	b.dftOnState.OnOff = nil
+	for i, s := range [][4]int{{0, 0, 2700, 50}, {0, 0, 2700, 100}, {0, 75, 0, 100}, {120, 75, 0, 100}} {
+		ps := smartbulb.PreferredState{Index: tpcommand.IntPtr(i)}
+		ps.Brightness = tpcommand.IntPtr(s[3])
+		if p.IsColor {
+			ps.Hue, ps.Saturation = tpcommand.IntPtr(s[0]), tpcommand.IntPtr(s[1])
+		}
+		if min, max, ok := p.TemperatureRange(); ok && s[2] != 0 {
+			ps.ColorTemp = tpcommand.IntPtr(clamp(s[2], min, max))
+		} else {
+			ps.ColorTemp = tpcommand.IntPtr(0)
+		}
+		b.preferred = append(b.preferred, ps)
+	}
+	b.methods = map[string]map[string]method{
+		"system": {
+			"get_sysinfo":   b.getSysInfo,
+			"set_dev_alias": b.setDevAlias,
+		},
+		"smartlife.iot.common.system": {
+			"set_dev_alias": b.setDevAlias,
+			"reboot":        b.reboot,
+		},
+		"smartlife.iot.smartbulb.lightingservice": {
+			"adjust_light_brightness": b.adjustLightBrightness,
+			"get_default_behavior":    b.getDefaultBehavior,
+			"get_light_details":       b.getLightDetails,
+			"get_light_state":         b.getLightState,
+			"get_preferred_state":     b.getPreferredState,
+			"set_default_behavior":    b.setDefaultBehavior,
+			"set_preferred_state":     b.setPreferredState,
+			"transition_light_state":  b.transitionLightState,
+		},
+		"smartlife.iot.common.schedule": {
+			"add_rule":           b.addRule,
+			"delete_all_rules":   b.deleteAllRules,
+			"delete_rule":        b.deleteRule,
+			"edit_rule":          b.editRule,
+			"erase_runtime_stat": b.empty,
+			"get_daystat":        b.getRuntimeDayStat,
+			"get_monthstat":      b.getRuntimeMonthStat,
+			"get_next_action":    b.getNextAction,
+			"get_rules":          b.getRules,
+			"set_overall_enable": b.setOverallEnable,
+		},
+		"smartlife.iot.common.timesetting": {
+			"get_time":     b.getTime,
+			"get_timezone": b.getTimeZone,
+			"set_timezone": b.setTimeZone,
+		},
+		"smartlife.iot.common.emeter": {
+			"erase_emeter_stat": b.eraseEmeterStat,
+			"get_daystat":       b.getEmeterDayStat,
+			"get_monthstat":     b.getEmeterMonthStat,
+			"get_realtime":      b.getRealTime,
+		},
+		"smartlife.iot.common.cloud": {
+			"get_info": b.getCloudInfo,
+		},
+	}
+	return b
+}
+
+// HandleRequest handles a JSON request.
+func (b *Bulb) HandleRequest(req []byte) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.updateEnergy()
+	return dispatch(req, b.methods)
+}
+
+// Request makes a request directly to the bulb.
+func (b *Bulb) Request(in, out interface{}) error {
+	req, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		return json.Unmarshal(resp, out)
+	}
+	return nil
+}
+
+func (b *Bulb) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
+
+// power returns the current power draw in mW.
+func (b *Bulb) power() int {
+	if *b.state.OnOff == 0 {
+		return 0
+	}
+	brightness := 100
+	if b.state.Brightness != nil {
+		brightness = *b.state.Brightness
+	}
+	return b.Profile.Wattage * 1000 * brightness / 100
+}
+
+// updateEnergy adds the energy used since the last update.
+func (b *Bulb) updateEnergy() {
+	now := b.now()
+	if !b.energyAt.IsZero() && now.After(b.energyAt) {
+		k := [3]int{now.Year(), int(now.Month()), now.Day()}
+		b.energy[k] += float64(b.power()) / 1000 * now.Sub(b.energyAt).Hours()
+	}
+	b.energyAt = now
+}
+
+func (b *Bulb) empty(json.RawMessage) (interface{}, error) {
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) getSysInfo(json.RawMessage) (interface{}, error) {
+	type lightState struct {
+		smartbulb.LightState
+		DftOnState *smartbulb.LightState `json:"dft_on_state,omitempty"`
+	}
+	var v struct {
+		smartbulb.GetSysInfoMethod
+		LightState *lightState `json:"light_state,omitempty"`
+	}
+	v.Alias = tpcommand.StrPtr(b.alias)
+	v.ActiveMode = tpcommand.StrPtr("none")
+	v.Description = tpcommand.StrPtr(b.Profile.Description)
+	v.DevState = tpcommand.StrPtr("normal")
+	v.DeviceID = tpcommand.StrPtr(b.DeviceID)
+	v.HwID = tpcommand.StrPtr(b.HwID)
+	v.HwVer = tpcommand.StrPtr(b.Profile.HwVer)
+	v.IsColor = boolInt(b.Profile.IsColor)
+	v.IsDimmable = boolInt(b.Profile.IsDimmable)
+	v.IsVariableColorTemp = boolInt(b.Profile.IsVariableColorTemp)
+	v.LEF = boolInt(b.Profile.LightingEffects)
+	v.MicMac = tpcommand.StrPtr(strings.ReplaceAll(b.MAC, ":", ""))
+	v.MicType = tpcommand.StrPtr("IOT.SMARTBULB")
+	v.Model = tpcommand.StrPtr(b.Profile.Model)
+	v.OemID = tpcommand.StrPtr(b.OemID)
+	v.PreferredState = &b.preferred
+	v.RSSI = tpcommand.IntPtr(b.RSSI)
+	v.SwVer = tpcommand.StrPtr(b.Profile.SwVer)
+	if *b.state.OnOff != 0 {
+		v.LightState = &lightState{LightState: b.state}
+	} else {
+		dft := b.dftOnState
+		v.LightState = &lightState{LightState: smartbulb.LightState{OnOff: tpcommand.IntPtr(0)}, DftOnState: &dft}
+	}
+	return v, nil
+}
+
+func (b *Bulb) setDevAlias(args json.RawMessage) (interface{}, error) {
+	var m device.SetDevAliasMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if m.Alias == nil || len(*m.Alias) > 31 {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid argument")
+	}
+	b.alias = *m.Alias
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) reboot(args json.RawMessage) (interface{}, error) {
+	var m device.RebootMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) lightState() smartbulb.GetLightStateMethod {
+	var v smartbulb.GetLightStateMethod
+	if *b.state.OnOff != 0 {
+		v.LightState = copyLightState(b.state)
+	} else {
+		dft := copyLightState(b.dftOnState)
+		v.OnOff = tpcommand.IntPtr(0)
+		v.DftOnState = &dft
+	}
+	return v
+}
+
+func (b *Bulb) getLightState(json.RawMessage) (interface{}, error) {
+	return b.lightState(), nil
+}
+
+func (b *Bulb) getLightDetails(json.RawMessage) (interface{}, error) {
+	return smartbulb.GetLightDetailsMethod{
+		ColorRenderingIndex:    tpcommand.IntPtr(80),
+		IncandescentEquivalent: tpcommand.IntPtr(60),
+		LampBeamAngle:          tpcommand.IntPtr(150),
+		MaxLumens:              tpcommand.IntPtr(b.Profile.MaxLumens),
+		MaxVoltage:             tpcommand.IntPtr(120),
+		MinVoltage:             tpcommand.IntPtr(110),
+		Wattage:                tpcommand.IntPtr(b.Profile.Wattage),
+	}, nil
+}
+
+// validate checks whether the light state is supported by the bulb.
+func (b *Bulb) validate(s smartbulb.LightState) error {
+	if s.Brightness != nil && (!b.Profile.IsDimmable || *s.Brightness < 0 || *s.Brightness > 100) {
+		return tpcommand.ErrInvalidArgument.WithMessage("invalid brightness")
+	}
+	if (s.Hue != nil || s.Saturation != nil) && !b.Profile.IsColor {
+		return tpcommand.ErrInvalidArgument.WithMessage("color not supported")
+	}
+	if s.Hue != nil && (*s.Hue < 0 || *s.Hue > 360) {
+		return tpcommand.ErrInvalidArgument.WithMessage("invalid hue")
+	}
+	if s.Saturation != nil && (*s.Saturation < 0 || *s.Saturation > 100) {
+		return tpcommand.ErrInvalidArgument.WithMessage("invalid saturation")
+	}
+	if s.ColorTemp != nil && *s.ColorTemp != 0 {
+		if min, max, ok := b.Profile.TemperatureRange(); !ok || *s.ColorTemp < min || *s.ColorTemp > max {
+			return tpcommand.ErrInvalidArgument.WithMessage("invalid color_temp")
+		}
+	}
+	if s.OnOff != nil && *s.OnOff != 0 && *s.OnOff != 1 {
+		return tpcommand.ErrInvalidArgument.WithMessage("invalid on_off")
+	}
+	return nil
+}
+
+// applyLightState merges the non-nil fields of s into d. If a hue or
+// saturation is set without a color temperature, the color temperature is
+// reset to switch to color mode.
+func applyLightState(d *smartbulb.LightState, s smartbulb.LightState) {
+	if s.Hue != nil || s.Saturation != nil {
+		d.ColorTemp = tpcommand.IntPtr(0)
+	}
+	for _, f := range [][2]**int{
+		{&d.Brightness, &s.Brightness},
+		{&d.Hue, &s.Hue},
+		{&d.Saturation, &s.Saturation},
+		{&d.ColorTemp, &s.ColorTemp},
+	} {
+		if *f[1] != nil {
+			*f[0] = tpcommand.IntPtr(**f[1])
+		}
+	}
+	if s.Mode != nil {
+		d.Mode = tpcommand.StrPtr(*s.Mode)
+	}
+}
+
+func (b *Bulb) transitionLightState(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.TransitionLightStateMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if err := b.validate(m.LightState); err != nil {
+		return nil, err
+	}
+	if m.TransitionPeriod != nil && *m.TransitionPeriod < 0 {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid transition_period")
+	}
+
+	on := *b.state.OnOff != 0
+	if m.OnOff != nil {
+		if *m.OnOff != 0 && !on {
+			on := copyLightState(b.dftOnState)
+			on.OnOff = tpcommand.IntPtr(1)
+			b.state = on
+		} else if *m.OnOff == 0 && on {
+			b.dftOnState = copyLightState(b.state)
+			b.dftOnState.OnOff = nil
+			b.state = smartbulb.LightState{OnOff: tpcommand.IntPtr(0)}
+		}
+		on = *m.OnOff != 0
+	}
+	if on {
+		applyLightState(&b.state, m.LightState)
+	} else {
+		applyLightState(&b.dftOnState, m.LightState)
+	}
+	return b.lightState(), nil
+}
+
+func (b *Bulb) adjustLightBrightness(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.AdjustLightBrightnessMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if !b.Profile.IsDimmable {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid brightness")
+	}
+	s := &b.state
+	if *b.state.OnOff == 0 {
+		s = &b.dftOnState
+	}
+	s.Brightness = tpcommand.IntPtr(clamp(*s.Brightness+m.Delta, 1, 100))
+	return b.lightState(), nil
+}
+
+func (b *Bulb) getPreferredState(json.RawMessage) (interface{}, error) {
+	return smartbulb.GetPreferredStateMethod{States: &b.preferred}, nil
+}
+
+func (b *Bulb) setPreferredState(args json.RawMessage) (interface{}, error) {
+	var m struct {
+		smartbulb.SetPreferredStateMethod
+		Index *int `json:"index,omitempty"`
+	}
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if m.Index == nil || *m.Index < 0 || *m.Index >= len(b.preferred) {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid index")
+	}
+	if err := b.validate(m.LightState); err != nil {
+		return nil, err
+	}
+	applyLightState(&b.preferred[*m.Index].LightState, m.LightState)
+	return b.preferred[*m.Index], nil
+}
+
+func (b *Bulb) getDefaultBehavior(json.RawMessage) (interface{}, error) {
+	hardOn, softOn := b.hardOn, b.softOn
+	return smartbulb.GetDefaultBehaviorMethod{HardOn: &hardOn, SoftOn: &softOn}, nil
+}
+
+func (b *Bulb) setDefaultBehavior(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.SetDefaultBehaviorMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	for _, s := range []*smartbulb.PreferredState{m.HardOn, m.SoftOn} {
+		if s == nil {
+			continue
+		}
+		if s.Mode == nil {
+			return nil, tpcommand.ErrInvalidArgument.WithMessage("missing mode")
+		}
+		switch *s.Mode {
+		case "last_status":
+		case "customize_preset":
+			if s.Index == nil || *s.Index < 0 || *s.Index >= len(b.preferred) {
+				return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid index")
+			}
+		default:
+			return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid mode")
+		}
+	}
+	if m.HardOn != nil {
+		b.hardOn = *m.HardOn
+	}
+	if m.SoftOn != nil {
+		b.softOn = *m.SoftOn
+	}
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) getRules(json.RawMessage) (interface{}, error) {
+	rules := append([]smartbulb.Rule{}, b.rules...)
+	return smartbulb.GetRulesMethod{
+		Enable:   tpcommand.IntPtr(b.rulesEnable),
+		RuleList: &rules,
+		Version:  tpcommand.IntPtr(2),
+	}, nil
+}
+
+func (b *Bulb) validateRule(r smartbulb.Rule) error {
+	if r.SAct == nil || r.STimeOpt == nil || r.SMin == nil || r.Enable == nil {
+		return tpcommand.ErrInvalidArgument.WithMessage("missing rule fields")
+	}
+	if *r.STimeOpt < -1 || *r.STimeOpt > 2 || *r.SMin < 0 || *r.SMin >= 24*60 {
+		return tpcommand.ErrInvalidArgument.WithMessage("invalid rule time")
+	}
+	if r.Wday != nil && len(*r.Wday) != 7 {
+		return tpcommand.ErrInvalidArgument.WithMessage("invalid wday")
+	}
+	for _, l := range []*smartbulb.LightState{r.SLight, r.ELight} {
+		if l != nil {
+			if err := b.validate(*l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Bulb) addRule(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.AddRuleMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if err := b.validateRule(m.Rule); err != nil {
+		return nil, err
+	}
+	if len(b.rules) >= 32 {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("table is full")
+	}
+	m.Rule.ID = tpcommand.StrPtr(strings.ToUpper(randomHex(16)))
+	b.rules = append(b.rules, m.Rule)
+	return smartbulb.AddRuleMethod{Rule: smartbulb.Rule{ID: m.Rule.ID}}, nil
+}
+
+func (b *Bulb) editRule(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.EditRuleMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	i := b.findRule(m.ID)
+	if i == -1 {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("rule not found")
+	}
+	if err := b.validateRule(m.Rule); err != nil {
+		return nil, err
+	}
+	b.rules[i] = m.Rule
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) deleteRule(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.DeleteRuleMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	i := b.findRule(m.ID)
+	if i == -1 {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("rule not found")
+	}
+	b.rules = append(b.rules[:i], b.rules[i+1:]...)
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) deleteAllRules(json.RawMessage) (interface{}, error) {
+	b.rules = nil
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) findRule(id *string) int {
+	if id != nil {
+		for i, r := range b.rules {
+			if *r.ID == *id {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (b *Bulb) setOverallEnable(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.SetOverallEnableMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if m.Enable == nil || (*m.Enable != 0 && *m.Enable != 1) {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid enable")
+	}
+	b.rulesEnable = *m.Enable
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) getNextAction(json.RawMessage) (interface{}, error) {
+	return smartbulb.GetNextActionMethod{Type: tpcommand.IntPtr(-1)}, nil
+}
+
+func (b *Bulb) getRuntimeDayStat(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.GetDayStatMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	return smartbulb.GetDayStatMethod{DayList: &[]map[string]interface{}{}}, nil
+}
+
+func (b *Bulb) getRuntimeMonthStat(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.GetMonthStatMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	return smartbulb.GetMonthStatMethod{DayList: &[]map[string]interface{}{}}, nil
+}
+
+func (b *Bulb) getTime(json.RawMessage) (interface{}, error) {
+	t := b.now().Add(b.timeOffset)
+	return smartbulb.GetTimeMethod{Time: smartbulb.Time{
+		Year:  tpcommand.IntPtr(t.Year()),
+		Month: tpcommand.IntPtr(int(t.Month())),
+		Mday:  tpcommand.IntPtr(t.Day()),
+		Hour:  tpcommand.IntPtr(t.Hour()),
+		Min:   tpcommand.IntPtr(t.Minute()),
+		Sec:   tpcommand.IntPtr(t.Second()),
+	}}, nil
+}
+
+func (b *Bulb) getTimeZone(json.RawMessage) (interface{}, error) {
+	return smartbulb.GetTimeZoneMethod{Index: tpcommand.IntPtr(b.tzIndex)}, nil
+}
+
+func (b *Bulb) setTimeZone(args json.RawMessage) (interface{}, error) {
+	var m struct {
+		smartbulb.SetTimeZoneMethod
+		Index *int `json:"index,omitempty"`
+	}
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if m.Index == nil || *m.Index < 0 || *m.Index > 109 {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("invalid index")
+	}
+	if m.Year != nil && m.Month != nil && m.Mday != nil && m.Hour != nil && m.Min != nil && m.Sec != nil {
+		now := b.now()
+		t := time.Date(*m.Year, time.Month(*m.Month), *m.Mday, *m.Hour, *m.Min, *m.Sec, 0, now.Location())
+		b.timeOffset = t.Sub(now)
+	}
+	b.tzIndex = *m.Index
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) getRealTime(json.RawMessage) (interface{}, error) {
+	return smartbulb.GetRealTimeMethod{PowerMW: tpcommand.IntPtr(b.power())}, nil
+}
+
+func (b *Bulb) getEmeterDayStat(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.GetDayStatMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if m.Year == nil || m.Month == nil {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("missing year or month")
+	}
+	days := []map[string]interface{}{}
+	for d := 1; d <= 31; d++ {
+		if wh, ok := b.energy[[3]int{*m.Year, *m.Month, d}]; ok {
+			days = append(days, map[string]interface{}{
+				"year":      *m.Year,
+				"month":     *m.Month,
+				"day":       d,
+				"energy_wh": int(wh),
+			})
+		}
+	}
+	return smartbulb.GetDayStatMethod{DayList: &days}, nil
+}
+
+func (b *Bulb) getEmeterMonthStat(args json.RawMessage) (interface{}, error) {
+	var m smartbulb.GetMonthStatMethod
+	if err := decode(args, &m); err != nil {
+		return nil, err
+	}
+	if m.Year == nil {
+		return nil, tpcommand.ErrInvalidArgument.WithMessage("missing year")
+	}
+	months := []map[string]interface{}{}
+	for mo := 1; mo <= 12; mo++ {
+		var wh float64
+		var ok bool
+		for k, v := range b.energy {
+			if k[0] == *m.Year && k[1] == mo {
+				wh, ok = wh+v, true
+			}
+		}
+		if ok {
+			months = append(months, map[string]interface{}{
+				"year":      *m.Year,
+				"month":     mo,
+				"energy_wh": int(wh),
+			})
+		}
+	}
+	return smartbulb.GetMonthStatMethod{DayList: &months}, nil
+}
+
+func (b *Bulb) eraseEmeterStat(json.RawMessage) (interface{}, error) {
+	b.energy = map[[3]int]float64{}
+	return tpcommand.Method{}, nil
+}
+
+func (b *Bulb) getCloudInfo(json.RawMessage) (interface{}, error) {
+	return smartbulb.GetInfoMethod{
+		Binded:       tpcommand.IntPtr(0),
+		CldCnnection: tpcommand.IntPtr(0),
+		FwDIPage:     tpcommand.StrPtr(""),
+		FwNotifyType: tpcommand.IntPtr(0),
+		IllegalType:  tpcommand.IntPtr(0),
+		Server:       tpcommand.StrPtr("n-devs.tplinkcloud.com"),
+		StopConnect:  tpcommand.IntPtr(0),
+		TcspInfo:     tpcommand.StrPtr(""),
+		TcspStatus:   tpcommand.IntPtr(0),
+		Username:     tpcommand.StrPtr(""),
+	}, nil
+}
+
+func copyLightState(s smartbulb.LightState) smartbulb.LightState {
+	var d smartbulb.LightState
+	applyLightState(&d, s)
+	if s.OnOff != nil {
+		d.OnOff = tpcommand.IntPtr(*s.OnOff)
+	}
+	return d
+}
+
+func boolInt(b bool) *int {
+	if b {
+		return tpcommand.IntPtr(1)
+	}
+	return tpcommand.IntPtr(0)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func randomHex(n int) string {
+	return hex.EncodeToString(randomBytes(n))
+}
+
+func randomMAC() string {
+	b := randomBytes(3)
+	return fmt.Sprintf("50:C7:BF:%02X:%02X:%02X", b[0], b[1], b[2])
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("sim: read random bytes: %w", err))
+	}
+	return b
+}
@@ -0,0 +1,207 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+)
+
+func TestBulbSysInfo(t *testing.T) {
+	for name, p := range Profiles {
+		var resp smartbulb.SmartBulbCommand
+		if err := NewBulb(p).Request(smartbulb.SmartBulbCommand{
+			SysInfo: &smartbulb.SysInfoModule{
+				GetSysInfo: &smartbulb.GetSysInfoMethod{},
+			},
+		}, &resp); err != nil {
+			t.Fatalf("%s: request: %v", name, err)
+		}
+		si := resp.SysInfo.GetSysInfo
+		if err := si.CheckError(); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if *si.Model != p.Model || (*si.IsColor != 0) != p.IsColor || (*si.IsDimmable != 0) != p.IsDimmable || (*si.IsVariableColorTemp != 0) != p.IsVariableColorTemp {
+			t.Errorf("%s: incorrect sysinfo", name)
+		}
+		if min, max, ok := si.GetTemperatureRange(); ok != p.IsVariableColorTemp {
+			t.Errorf("%s: expected variable color temp to be %t", name, p.IsVariableColorTemp)
+		} else if ok && *si.LightState.ColorTemp != min {
+			t.Errorf("%s: expected initial color temp to be %d (range %d-%d), got %d", name, min, min, max, *si.LightState.ColorTemp)
+		}
+	}
+}
+
+func TestBulbTransition(t *testing.T) {
+	for _, tc := range []struct {
+		Model string
+		State smartbulb.LightState
+		Error tpcommand.ErrorCode
+	}{
+		{"KL130", smartbulb.LightState{Hue: tpcommand.IntPtr(120), Saturation: tpcommand.IntPtr(50)}, 0},
+		{"KL130", smartbulb.LightState{ColorTemp: tpcommand.IntPtr(9000)}, 0},
+		{"KL130", smartbulb.LightState{Hue: tpcommand.IntPtr(361)}, tpcommand.ErrInvalidArgument},
+		{"LB120", smartbulb.LightState{ColorTemp: tpcommand.IntPtr(6500)}, 0},
+		{"LB120", smartbulb.LightState{ColorTemp: tpcommand.IntPtr(9000)}, tpcommand.ErrInvalidArgument},
+		{"LB120", smartbulb.LightState{Hue: tpcommand.IntPtr(120)}, tpcommand.ErrInvalidArgument},
+		{"KL110", smartbulb.LightState{Brightness: tpcommand.IntPtr(10)}, 0},
+		{"KL110", smartbulb.LightState{ColorTemp: tpcommand.IntPtr(2700)}, tpcommand.ErrInvalidArgument},
+	} {
+		b := NewBulb(Profiles[tc.Model])
+
+		var resp smartbulb.SmartBulbCommand
+		if err := b.Request(smartbulb.SmartBulbCommand{
+			LightingService: &smartbulb.LightingServiceModule{
+				TransitionLightState: &smartbulb.TransitionLightStateMethod{
+					LightState: tc.State,
+				},
+			},
+		}, &resp); err != nil {
+			t.Fatalf("%s: request: %v", tc.Model, err)
+		}
+
+		m := resp.LightingService.TransitionLightState
+		if err := m.CheckError(); tc.Error != 0 {
+			if terr, ok := err.(tpcommand.Error); !ok || terr.Code != tc.Error {
+				t.Errorf("%s %+v: expected error %s, got %v", tc.Model, tc.State, tc.Error, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s %+v: unexpected error: %v", tc.Model, tc.State, err)
+			continue
+		}
+
+		for _, f := range [][2]*int{
+			{tc.State.Hue, m.Hue},
+			{tc.State.Saturation, m.Saturation},
+			{tc.State.ColorTemp, m.ColorTemp},
+			{tc.State.Brightness, m.Brightness},
+		} {
+			if f[0] != nil && (f[1] == nil || *f[0] != *f[1]) {
+				t.Errorf("%s %+v: state not applied", tc.Model, tc.State)
+			}
+		}
+	}
+}
+
+func TestBulbOnOff(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBulb(Profiles["KL130"])
+	b.Now = func() time.Time { return now }
+
+	transition := func(s smartbulb.LightState) *smartbulb.TransitionLightStateMethod {
+		var resp smartbulb.SmartBulbCommand
+		if err := b.Request(smartbulb.SmartBulbCommand{
+			LightingService: &smartbulb.LightingServiceModule{
+				TransitionLightState: &smartbulb.TransitionLightStateMethod{LightState: s},
+			},
+		}, &resp); err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if err := resp.LightingService.TransitionLightState.CheckError(); err != nil {
+			t.Fatalf("transition: %v", err)
+		}
+		return resp.LightingService.TransitionLightState
+	}
+
+	transition(smartbulb.LightState{Brightness: tpcommand.IntPtr(50)})
+	now = now.Add(time.Hour * 2)
+
+	if m := transition(smartbulb.LightState{OnOff: tpcommand.IntPtr(0)}); *m.OnOff != 0 || m.DftOnState == nil || *m.DftOnState.Brightness != 50 {
+		t.Errorf("expected bulb to be off with the previous state saved")
+	}
+	if m := transition(smartbulb.LightState{Brightness: tpcommand.IntPtr(75)}); *m.OnOff != 0 || *m.DftOnState.Brightness != 75 {
+		t.Errorf("expected bulb to stay off and update the saved state")
+	}
+	if m := transition(smartbulb.LightState{OnOff: tpcommand.IntPtr(1)}); *m.OnOff != 1 || *m.Brightness != 75 {
+		t.Errorf("expected bulb to turn on with the saved state")
+	}
+
+	var resp smartbulb.SmartBulbCommand
+	if err := b.Request(smartbulb.SmartBulbCommand{
+		Emeter: &smartbulb.EmeterModule{
+			GetDayStat: &smartbulb.GetDayStatMethod{Year: tpcommand.IntPtr(2021), Month: tpcommand.IntPtr(6)},
+		},
+	}, &resp); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if d := *resp.Emeter.GetDayStat.DayList; len(d) != 1 || d[0]["energy_wh"].(float64) != 10 {
+		t.Errorf("expected 10 Wh to be used, got %v", d)
+	}
+}
+
+func TestBulbRules(t *testing.T) {
+	b := NewBulb(Profiles["KL130"])
+
+	rule := smartbulb.Rule{
+		Enable:   tpcommand.IntPtr(1),
+		SAct:     tpcommand.IntPtr(1),
+		STimeOpt: tpcommand.IntPtr(0),
+		SMin:     tpcommand.IntPtr(60 * 7),
+		Wday:     &[]int{0, 1, 1, 1, 1, 1, 0},
+		Name:     tpcommand.StrPtr("test"),
+	}
+
+	var resp smartbulb.SmartBulbCommand
+	if err := b.Request(smartbulb.SmartBulbCommand{
+		Schedule: &smartbulb.ScheduleModule{AddRule: &smartbulb.AddRuleMethod{Rule: rule}},
+	}, &resp); err != nil {
+		t.Fatalf("request: %v", err)
+	} else if err := resp.Schedule.AddRule.CheckError(); err != nil {
+		t.Fatalf("add rule: %v", err)
+	}
+	id := resp.Schedule.AddRule.ID
+
+	rule.ID = id
+	rule.Name = tpcommand.StrPtr("test1")
+	resp = smartbulb.SmartBulbCommand{}
+	if err := b.Request(smartbulb.SmartBulbCommand{
+		Schedule: &smartbulb.ScheduleModule{
+			EditRule: &smartbulb.EditRuleMethod{Rule: rule},
+			GetRules: &smartbulb.GetRulesMethod{},
+		},
+	}, &resp); err != nil {
+		t.Fatalf("request: %v", err)
+	} else if err := resp.Schedule.EditRule.CheckError(); err != nil {
+		t.Fatalf("edit rule: %v", err)
+	} else if rs := *resp.Schedule.GetRules.RuleList; len(rs) != 1 || *rs[0].ID != *id || *rs[0].Name != "test1" {
+		t.Errorf("incorrect rules after edit: %+v", rs)
+	}
+
+	for i, expected := range []tpcommand.ErrorCode{0, tpcommand.ErrInvalidArgument} {
+		resp = smartbulb.SmartBulbCommand{}
+		if err := b.Request(smartbulb.SmartBulbCommand{
+			Schedule: &smartbulb.ScheduleModule{DeleteRule: &smartbulb.DeleteRuleMethod{ID: id}},
+		}, &resp); err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if err := resp.Schedule.DeleteRule.CheckError(); expected == 0 && err != nil {
+			t.Errorf("delete rule %d: unexpected error: %v", i, err)
+		} else if expected != 0 && (err == nil || err.(tpcommand.Error).Code != expected) {
+			t.Errorf("delete rule %d: expected error %s, got %v", i, expected, err)
+		}
+	}
+}
+
+func TestBulbNotSupported(t *testing.T) {
+	var resp struct {
+		Module tpcommand.Checked `json:"smartlife.iot.unknown"`
+		System struct {
+			Method tpcommand.Checked `json:"unknown"`
+		} `json:"system"`
+	}
+	if err := NewBulb(Profiles["KL110"]).Request(map[string]interface{}{
+		"smartlife.iot.unknown": map[string]interface{}{"get_info": nil},
+		"system":                map[string]interface{}{"unknown": nil},
+	}, &resp); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if err := resp.Module.CheckError(); err == nil || err.(tpcommand.Error).Code != tpcommand.ErrModuleNotSupport {
+		t.Errorf("expected module not supported error, got %v", err)
+	}
+	if err := resp.System.Method.CheckError(); err == nil || err.(tpcommand.Error).Code != tpcommand.ErrMethodNotSupport {
+		t.Errorf("expected method not supported error, got %v", err)
+	}
+}
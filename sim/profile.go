@@ -0,0 +1,113 @@
+// Package sim implements simulated TP-Link smart devices for testing.
+package sim
+
+import "github.com/pgaskin/kasa/tpcommand/smartbulb"
+
+// Profile describes the capabilities of a smart bulb model.
+type Profile struct {
+	Model               string // also determines the color temperature range
+	Description         string
+	HwVer               string
+	SwVer               string
+	IsColor             bool
+	IsDimmable          bool
+	IsVariableColorTemp bool
+	LightingEffects     bool // whether the LEF flag is set
+	Wattage             int  // power draw at full brightness, in watts
+	MaxLumens           int
+}
+
+// TemperatureRange returns the color temperature range of the model.
+func (p Profile) TemperatureRange() (min, max int, ok bool) {
+	if !p.IsVariableColorTemp {
+		return 0, 0, false
+	}
+	return smartbulb.GetSysInfoMethod{Model: &p.Model}.GetTemperatureRange()
+}
+
+// Profiles contains profiles for common smart bulb models.
+var Profiles = map[string]Profile{
+	"KL110": {
+		Model:       "KL110",
+		Description: "Smart Wi-Fi LED Bulb with Dimmable Light",
+		HwVer:       "1.0",
+		SwVer:       "1.8.11 Build 191113 Rel.105336",
+		IsDimmable:  true,
+		Wattage:     10,
+		MaxLumens:   800,
+	},
+	"KL120": {
+		Model:               "KL120",
+		Description:         "Smart Wi-Fi LED Bulb with Tunable White Light",
+		HwVer:               "1.0",
+		SwVer:               "1.8.11 Build 191113 Rel.105336",
+		IsDimmable:          true,
+		IsVariableColorTemp: true,
+		Wattage:             10,
+		MaxLumens:           800,
+	},
+	"KL125": {
+		Model:               "KL125",
+		Description:         "Smart Wi-Fi LED Bulb with Color Changing",
+		HwVer:               "1.0",
+		SwVer:               "1.0.5 Build 200831 Rel.141525",
+		IsColor:             true,
+		IsDimmable:          true,
+		IsVariableColorTemp: true,
+		Wattage:             9,
+		MaxLumens:           800,
+	},
+	"KL130": {
+		Model:               "KL130",
+		Description:         "Smart Wi-Fi LED Bulb with Color Changing",
+		HwVer:               "1.0",
+		SwVer:               "1.8.11 Build 191113 Rel.105336",
+		IsColor:             true,
+		IsDimmable:          true,
+		IsVariableColorTemp: true,
+		Wattage:             10,
+		MaxLumens:           800,
+	},
+	"KL430": {
+		Model:               "KL430",
+		Description:         "Kasa Smart Light Strip, 16 Color Zones",
+		HwVer:               "1.0",
+		SwVer:               "1.0.10 Build 200522 Rel.104340",
+		IsColor:             true,
+		IsDimmable:          true,
+		IsVariableColorTemp: true,
+		LightingEffects:     true,
+		Wattage:             12,
+		MaxLumens:           800,
+	},
+	"LB100": {
+		Model:       "LB100",
+		Description: "Smart Wi-Fi LED Bulb with Dimmable Light",
+		HwVer:       "1.0",
+		SwVer:       "1.4.3 Build 170504 Rel.144921",
+		IsDimmable:  true,
+		Wattage:     9,
+		MaxLumens:   800,
+	},
+	"LB120": {
+		Model:               "LB120",
+		Description:         "Smart Wi-Fi LED Bulb with Tunable White Light",
+		HwVer:               "1.0",
+		SwVer:               "1.4.3 Build 170504 Rel.144921",
+		IsDimmable:          true,
+		IsVariableColorTemp: true,
+		Wattage:             11,
+		MaxLumens:           800,
+	},
+	"LB130": {
+		Model:               "LB130",
+		Description:         "Smart Wi-Fi LED Bulb with Color Changing",
+		HwVer:               "1.0",
+		SwVer:               "1.6.0 Build 170703 Rel.141938",
+		IsColor:             true,
+		IsDimmable:          true,
+		IsVariableColorTemp: true,
+		Wattage:             11,
+		MaxLumens:           800,
+	},
+}
@@ -0,0 +1,143 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pgaskin/kasa/tpcommand"
+)
+
+// method handles a method call. If the returned error is a tpcommand.Error, it
+// will be returned as-is, otherwise, it will be returned as
+// tpcommand.ErrInvalidArgument.
+type method func(args json.RawMessage) (interface{}, error)
+
+// dispatch calls the methods of each module in req in the order they appear,
+// and returns the response. The context module is ignored.
+func dispatch(req []byte, modules map[string]map[string]method) ([]byte, error) {
+	in, order, err := orderedObject(req)
+	if err != nil {
+		return nil, fmt.Errorf("parse request: %w", err)
+	}
+
+	out := map[string]interface{}{}
+	for _, mod := range order {
+		buf := in[mod]
+		if mod == "context" {
+			continue
+		}
+
+		ms, ok := modules[mod]
+		if !ok {
+			out[mod] = errorResponse(tpcommand.ErrModuleNotSupport.WithMessage("module not support"))
+			continue
+		}
+
+		calls, names, err := orderedObject(buf)
+		if err != nil {
+			out[mod] = errorResponse(err)
+			continue
+		}
+
+		res := map[string]interface{}{}
+		for _, name := range names {
+			args := calls[name]
+			m, ok := ms[name]
+			if !ok {
+				res[name] = errorResponse(tpcommand.ErrMethodNotSupport.WithMessage("member not support"))
+				continue
+			}
+			if v, err := m(args); err != nil {
+				res[name] = errorResponse(err)
+			} else if v, err := successResponse(v); err != nil {
+				return nil, fmt.Errorf("encode %s.%s response: %w", mod, name, err)
+			} else {
+				res[name] = v
+			}
+		}
+		out[mod] = res
+	}
+	return json.Marshal(out)
+}
+
+// orderedObject parses a JSON object, also returning the keys in the order
+// they appear. If a key is duplicated, the last value is used.
+func orderedObject(buf []byte) (map[string]json.RawMessage, []string, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return nil, nil, err
+	}
+	if obj == nil {
+		return nil, nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	keys := make([]string, 0, len(obj))
+	seen := make(map[string]bool, len(obj))
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		if k := tok.(string); !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+	}
+	return obj, keys, nil
+}
+
+// successResponse sets err_code to zero in the JSON object v if it isn't
+// already set.
+func successResponse(v interface{}) (map[string]json.RawMessage, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		obj = map[string]json.RawMessage{}
+	}
+	if _, ok := obj["err_code"]; !ok {
+		obj["err_code"] = json.RawMessage(`0`)
+	}
+	return obj, nil
+}
+
+func errorResponse(err error) tpcommand.Checked {
+	var terr tpcommand.Error
+	if !errors.As(err, &terr) {
+		terr = tpcommand.Error{
+			Code:    tpcommand.ErrInvalidArgument,
+			Message: err.Error(),
+		}
+	}
+	return tpcommand.Checked{
+		ErrCode: tpcommand.IntPtr(int(terr.Code)),
+		ErrMsg:  tpcommand.StrPtr(terr.Message),
+	}
+}
+
+// decode decodes method arguments, treating an empty argument as an empty
+// object.
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 || string(args) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return tpcommand.ErrInvalidArgument.WithMessage("invalid argument")
+	}
+	return nil
+}
@@ -12,8 +12,9 @@ type DeviceCommand struct {
 // com.tplink.kasa_android@2.35.0.1021/com.tplinkra.tpcommon.model.smartlife.iot.common.Context
 type ContextModule struct {
 	tpcommand.Module
-	Source *string `json:"source,omitempty"`
-	TID    *int    `json:"tid,omitempty"`
+	ChildIDs *[]string `json:"child_ids,omitempty"` // for power strips, the outlets the command applies to
+	Source   *string   `json:"source,omitempty"`
+	TID      *int      `json:"tid,omitempty"`
 }
 
 // com.tplink.kasa_android@2.35.0.1021/com.tplinkra.tpcommon.model.smartlife.iot.common.system.System
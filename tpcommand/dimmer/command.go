@@ -0,0 +1,96 @@
+// Package dimmer contains types for TP-Link wall dimmers (e.g., HS220,
+// KS230), which are smart plugs with an additional dimmer module.
+package dimmer
+
+import (
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartplug"
+)
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand
+// note: only the dimmer module is added since the rest is shared with smart plugs
+type DimmerCommand struct {
+	smartplug.SmartPlugCommand
+	Dimmer *DimmerModule `json:"smartlife.iot.dimmer,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer
+type DimmerModule struct {
+	tpcommand.Module
+	CalibrateBrightness  *CalibrateBrightnessMethod  `json:"calibrate_brightness,omitempty"`
+	GetDimmerParameters  *GetDimmerParametersMethod  `json:"get_dimmer_parameters,omitempty"`
+	SetBrightness        *SetBrightnessMethod        `json:"set_brightness,omitempty"`
+	SetDimmerTransition  *SetDimmerTransitionMethod  `json:"set_dimmer_transition,omitempty"`
+	SetDoubleClickAction *SetDoubleClickActionMethod `json:"set_double_click_action,omitempty"`
+	SetFadeOffTime       *SetFadeOffTimeMethod       `json:"set_fade_off_time,omitempty"`
+	SetFadeOnTime        *SetFadeOnTimeMethod        `json:"set_fade_on_time,omitempty"`
+	SetGentleOffTime     *SetGentleOffTimeMethod     `json:"set_gentle_off_time,omitempty"`
+	SetGentleOnTime      *SetGentleOnTimeMethod      `json:"set_gentle_on_time,omitempty"`
+	SetLongPressAction   *SetLongPressActionMethod   `json:"set_long_press_action,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.CalibrateBrightness
+type CalibrateBrightnessMethod struct {
+	tpcommand.Method
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.GetDimmerParameters
+type GetDimmerParametersMethod struct {
+	tpcommand.Method
+	BulbType      *int `json:"bulb_type,omitempty"`
+	FadeOffTime   *int `json:"fadeOffTime,omitempty"`   // milliseconds
+	FadeOnTime    *int `json:"fadeOnTime,omitempty"`    // milliseconds
+	GentleOffTime *int `json:"gentleOffTime,omitempty"` // milliseconds
+	GentleOnTime  *int `json:"gentleOnTime,omitempty"`  // milliseconds
+	MinThreshold  *int `json:"minThreshold,omitempty"`  // minimum brightness (set by calibrate_brightness)
+	RampRate      *int `json:"rampRate,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetBrightness
+type SetBrightnessMethod struct {
+	tpcommand.Method
+	Brightness *int `json:"brightness,omitempty"` // 1-100
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetDimmerTransition
+type SetDimmerTransitionMethod struct {
+	tpcommand.Method
+	Brightness *int `json:"brightness,omitempty"` // 0-100 (0 turns off the relay)
+	Duration   *int `json:"duration,omitempty"`   // milliseconds
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetDoubleClickAction
+type SetDoubleClickActionMethod struct {
+	tpcommand.Method
+	Mode *string `json:"mode,omitempty"` // none, instant_on_off, gentle_on_off, customize_preset
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetFadeOffTime
+type SetFadeOffTimeMethod struct {
+	tpcommand.Method
+	FadeTime *int `json:"fadeTime,omitempty"` // milliseconds
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetFadeOnTime
+type SetFadeOnTimeMethod struct {
+	tpcommand.Method
+	FadeTime *int `json:"fadeTime,omitempty"` // milliseconds
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetGentleOffTime
+type SetGentleOffTimeMethod struct {
+	tpcommand.Method
+	Duration *int `json:"duration,omitempty"` // milliseconds
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetGentleOnTime
+type SetGentleOnTimeMethod struct {
+	tpcommand.Method
+	Duration *int `json:"duration,omitempty"` // milliseconds
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Dimmer.SetLongPressAction
+type SetLongPressActionMethod struct {
+	tpcommand.Method
+	Mode *string `json:"mode,omitempty"` // none, instant_on_off, gentle_on_off, customize_preset
+}
@@ -0,0 +1,45 @@
+package dimmer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartplug"
+)
+
+func TestDimmerCommand(t *testing.T) {
+	// HS220(US) 2.0, firmware 1.0.3 (trimmed)
+	const resp = `{"system":{"get_sysinfo":{"sw_ver":"1.0.3 Build 200326 Rel.082355","hw_ver":"2.0","model":"HS220(US)","mic_type":"IOT.SMARTPLUGSWITCH","relay_state":1,"brightness":42,"err_code":0}},"smartlife.iot.dimmer":{"get_dimmer_parameters":{"minThreshold":11,"fadeOnTime":1000,"fadeOffTime":1000,"gentleOnTime":3000,"gentleOffTime":10000,"rampRate":30,"bulb_type":1,"err_code":0}}}`
+
+	var c DimmerCommand
+	if err := json.Unmarshal([]byte(resp), &c); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if s := c.System.GetSysInfo; *s.Model != "HS220(US)" || *s.Brightness != 42 {
+		t.Errorf("incorrect sysinfo %#v", s)
+	}
+	if p := c.Dimmer.GetDimmerParameters; p.CheckError() != nil || *p.MinThreshold != 11 || *p.GentleOffTime != 10000 || *p.BulbType != 1 {
+		t.Errorf("incorrect dimmer parameters %#v", p)
+	}
+
+	buf, err := json.Marshal(DimmerCommand{
+		SmartPlugCommand: smartplug.SmartPlugCommand{
+			System: &smartplug.SystemModule{
+				SetRelayState: &smartplug.SetRelayStateMethod{State: tpcommand.IntPtr(1)},
+			},
+		},
+		Dimmer: &DimmerModule{
+			SetDimmerTransition: &SetDimmerTransitionMethod{
+				Brightness: tpcommand.IntPtr(75),
+				Duration:   tpcommand.IntPtr(500),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if exp := `{"system":{"set_relay_state":{"state":1}},"smartlife.iot.dimmer":{"set_dimmer_transition":{"brightness":75,"duration":500}}}`; string(buf) != exp {
+		t.Errorf("expected %s, got %s", exp, buf)
+	}
+}
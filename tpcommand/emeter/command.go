@@ -0,0 +1,140 @@
+// Package emeter contains types for the energy meter of TP-Link smart plugs.
+//
+// Hardware version 1 devices (e.g., HS110 v1) report floating-point values in
+// volts, amps, watts, and kilowatt-hours (voltage, current, power, total,
+// energy), while newer ones report integer values in millivolts, milliamps,
+// milliwatts, and watt-hours (voltage_mv, current_ma, power_mw, total_wh,
+// energy_wh). Both are decoded into the latter.
+package emeter
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/pgaskin/kasa/tpcommand"
+)
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter
+type EmeterModule struct {
+	tpcommand.Module
+	EraseEmeterStat *EraseEmeterStatMethod `json:"erase_emeter_stat,omitempty"`
+	GetDayStat      *GetDayStatMethod      `json:"get_daystat,omitempty"`
+	GetMonthStat    *GetMonthStatMethod    `json:"get_monthstat,omitempty"`
+	GetRealTime     *GetRealTimeMethod     `json:"get_realtime,omitempty"`
+	GetVGainIGain   *GetVGainIGainMethod   `json:"get_vgain_igain,omitempty"`
+	SetVGainIGain   *SetVGainIGainMethod   `json:"set_vgain_igain,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.EraseEmeterStat
+type EraseEmeterStatMethod struct {
+	tpcommand.Method
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.DayStat
+type DayStat struct {
+	Day      *int `json:"day,omitempty"`
+	EnergyWh *int `json:"energy_wh,omitempty"`
+	Month    *int `json:"month,omitempty"`
+	Year     *int `json:"year,omitempty"`
+}
+
+func (s *DayStat) UnmarshalJSON(b []byte) error {
+	type plain DayStat
+	var v struct {
+		plain
+		Energy *float64 `json:"energy,omitempty"` // legacy, kWh
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = DayStat(v.plain)
+	s.EnergyWh = normalize(s.EnergyWh, v.Energy, 1000)
+	return nil
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.MonthStat
+type MonthStat struct {
+	EnergyWh *int `json:"energy_wh,omitempty"`
+	Month    *int `json:"month,omitempty"`
+	Year     *int `json:"year,omitempty"`
+}
+
+func (s *MonthStat) UnmarshalJSON(b []byte) error {
+	type plain MonthStat
+	var v struct {
+		plain
+		Energy *float64 `json:"energy,omitempty"` // legacy, kWh
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = MonthStat(v.plain)
+	s.EnergyWh = normalize(s.EnergyWh, v.Energy, 1000)
+	return nil
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.GetDayStat
+type GetDayStatMethod struct {
+	tpcommand.Method
+	DayList *[]DayStat `json:"day_list,omitempty"`
+	Month   *int       `json:"month,omitempty"`
+	Year    *int       `json:"year,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.GetMonthStat
+type GetMonthStatMethod struct {
+	tpcommand.Method
+	MonthList *[]MonthStat `json:"month_list,omitempty"`
+	Year      *int         `json:"year,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.GetRealTime
+type GetRealTimeMethod struct {
+	tpcommand.Method
+	CurrentMA *int `json:"current_ma,omitempty"`
+	PowerMW   *int `json:"power_mw,omitempty"`
+	TotalWh   *int `json:"total_wh,omitempty"` // since the stats were last erased
+	VoltageMV *int `json:"voltage_mv,omitempty"`
+}
+
+func (m *GetRealTimeMethod) UnmarshalJSON(b []byte) error {
+	type plain GetRealTimeMethod
+	var v struct {
+		plain
+		Current *float64 `json:"current,omitempty"` // legacy, A
+		Power   *float64 `json:"power,omitempty"`   // legacy, W
+		Total   *float64 `json:"total,omitempty"`   // legacy, kWh
+		Voltage *float64 `json:"voltage,omitempty"` // legacy, V
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*m = GetRealTimeMethod(v.plain)
+	m.CurrentMA = normalize(m.CurrentMA, v.Current, 1000)
+	m.PowerMW = normalize(m.PowerMW, v.Power, 1000)
+	m.TotalWh = normalize(m.TotalWh, v.Total, 1000)
+	m.VoltageMV = normalize(m.VoltageMV, v.Voltage, 1000)
+	return nil
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.GetVGainIGain
+type GetVGainIGainMethod struct {
+	tpcommand.Method
+	IGain *int `json:"igain,omitempty"`
+	VGain *int `json:"vgain,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Emeter.SetVGainIGain
+type SetVGainIGainMethod struct {
+	tpcommand.Method
+	IGain *int `json:"igain,omitempty"`
+	VGain *int `json:"vgain,omitempty"`
+}
+
+// normalize returns v if it is set, otherwise legacy scaled by mult.
+func normalize(v *int, legacy *float64, mult float64) *int {
+	if v != nil || legacy == nil {
+		return v
+	}
+	return tpcommand.IntPtr(int(math.Round(*legacy * mult)))
+}
@@ -0,0 +1,52 @@
+package emeter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetRealTime(t *testing.T) {
+	for _, tc := range []struct {
+		Name string
+		JSON string
+	}{
+		{"V1", `{"current":0.012345,"voltage":120.456789,"power":1.234567,"total":0.5,"err_code":0}`},
+		{"V2", `{"current_ma":12,"voltage_mv":120457,"power_mw":1235,"total_wh":500,"err_code":0}`},
+	} {
+		var m GetRealTimeMethod
+		if err := json.Unmarshal([]byte(tc.JSON), &m); err != nil {
+			t.Errorf("%s: unmarshal: %v", tc.Name, err)
+			continue
+		}
+		if m.CheckError() != nil || m.ErrCode == nil {
+			t.Errorf("%s: expected err_code to be decoded", tc.Name)
+		}
+		if m.CurrentMA == nil || *m.CurrentMA != 12 || m.VoltageMV == nil || *m.VoltageMV != 120457 || m.PowerMW == nil || *m.PowerMW != 1235 || m.TotalWh == nil || *m.TotalWh != 500 {
+			t.Errorf("%s: incorrect values %#v", tc.Name, m)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	for _, tc := range []struct {
+		Name string
+		JSON string
+	}{
+		{"V1", `{"emeter":{"get_daystat":{"day_list":[{"year":2021,"month":1,"day":2,"energy":0.123}],"err_code":0},"get_monthstat":{"month_list":[{"year":2021,"month":1,"energy":1.5}],"err_code":0}}}`},
+		{"V2", `{"emeter":{"get_daystat":{"day_list":[{"year":2021,"month":1,"day":2,"energy_wh":123}],"err_code":0},"get_monthstat":{"month_list":[{"year":2021,"month":1,"energy_wh":1500}],"err_code":0}}}`},
+	} {
+		var c struct {
+			Emeter EmeterModule `json:"emeter"`
+		}
+		if err := json.Unmarshal([]byte(tc.JSON), &c); err != nil {
+			t.Errorf("%s: unmarshal: %v", tc.Name, err)
+			continue
+		}
+		if d := c.Emeter.GetDayStat; d == nil || d.DayList == nil || len(*d.DayList) != 1 || *(*d.DayList)[0].Day != 2 || *(*d.DayList)[0].EnergyWh != 123 {
+			t.Errorf("%s: incorrect day stats %#v", tc.Name, d)
+		}
+		if m := c.Emeter.GetMonthStat; m == nil || m.MonthList == nil || len(*m.MonthList) != 1 || *(*m.MonthList)[0].Month != 1 || *(*m.MonthList)[0].EnergyWh != 1500 {
+			t.Errorf("%s: incorrect month stats %#v", tc.Name, m)
+		}
+	}
+}
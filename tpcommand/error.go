@@ -79,6 +79,13 @@ func (c ErrorCode) WithMessagef(format string, a ...interface{}) error {
 	return c.WithMessage(fmt.Sprintf(format, a...))
 }
 
+// Error codes returned by devices for unsupported or invalid requests.
+const (
+	ErrModuleNotSupport ErrorCode = -1
+	ErrMethodNotSupport ErrorCode = -2
+	ErrInvalidArgument  ErrorCode = -3
+)
+
 const (
 	ACCOUNT_FEATURES_DATASET_CORRUPTED                         ErrorCode = -94005
 	ACCOUNT_FEATURES_DEVICE_ADDRESS_REQUIRED                   ErrorCode = -94011
@@ -0,0 +1,17 @@
+// Package ks220m contains types for TP-Link wall dimmers with motion and
+// ambient light sensors (e.g., KS220M).
+package ks220m
+
+import (
+	"github.com/pgaskin/kasa/tpcommand/dimmer"
+	"github.com/pgaskin/kasa/tpcommand/las"
+	"github.com/pgaskin/kasa/tpcommand/pir"
+)
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand
+// note: only the sensor modules are added since the rest is shared with dimmers
+type KS220MCommand struct {
+	dimmer.DimmerCommand
+	LAS *las.LASModule `json:"smartlife.iot.LAS,omitempty"`
+	PIR *pir.PIRModule `json:"smartlife.iot.PIR,omitempty"`
+}
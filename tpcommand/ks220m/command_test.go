@@ -0,0 +1,44 @@
+package ks220m
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/dimmer"
+	"github.com/pgaskin/kasa/tpcommand/las"
+	"github.com/pgaskin/kasa/tpcommand/pir"
+)
+
+func TestKS220MCommand(t *testing.T) {
+	buf, err := json.Marshal(KS220MCommand{
+		DimmerCommand: dimmer.DimmerCommand{
+			Dimmer: &dimmer.DimmerModule{
+				SetBrightness: &dimmer.SetBrightnessMethod{Brightness: tpcommand.IntPtr(50)},
+			},
+		},
+		LAS: &las.LASModule{
+			SetBrtLevel: &las.SetBrtLevelMethod{Index: tpcommand.IntPtr(0), Value: tpcommand.IntPtr(30)},
+		},
+		PIR: &pir.PIRModule{
+			SetEnable: &pir.SetEnableMethod{Enable: tpcommand.IntPtr(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if exp := `{"smartlife.iot.dimmer":{"set_brightness":{"brightness":50}},"smartlife.iot.LAS":{"set_brt_level":{"index":0,"value":30}},"smartlife.iot.PIR":{"set_enable":{"enable":1}}}`; string(buf) != exp {
+		t.Errorf("expected %s, got %s", exp, buf)
+	}
+
+	var c KS220MCommand
+	if err := json.Unmarshal([]byte(`{"system":{"get_sysinfo":{"model":"KS220M(US)","brightness":50,"err_code":0}},"smartlife.iot.PIR":{"set_enable":{"err_code":0}}}`), &c); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if s := c.System.GetSysInfo; *s.Model != "KS220M(US)" || *s.Brightness != 50 {
+		t.Errorf("incorrect sysinfo %#v", s)
+	}
+	if m := c.PIR.SetEnable; m.CheckError() != nil {
+		t.Errorf("incorrect pir response %#v", m)
+	}
+}
@@ -0,0 +1,57 @@
+// Package las contains types for the ambient light sensor of TP-Link switches
+// (e.g., KS220M).
+package las
+
+import "github.com/pgaskin/kasa/tpcommand"
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.LAS
+type LASModule struct {
+	tpcommand.Module
+	GetConfig     *GetConfigMethod     `json:"get_config,omitempty"`
+	GetCurrentBrt *GetCurrentBrtMethod `json:"get_current_brt,omitempty"`
+	SetBrtLevel   *SetBrtLevelMethod   `json:"set_brt_level,omitempty"`
+	SetEnable     *SetEnableMethod     `json:"set_enable,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.LAS.Dev
+type Dev struct {
+	DarkIndex  *int     `json:"dark_index,omitempty"` // index into LevelArray of the threshold in use
+	Enable     *int     `json:"enable,omitempty"`     // disabled (0), enabled (1)
+	HwID       *int     `json:"hw_id,omitempty"`
+	LevelArray *[]Level `json:"level_array,omitempty"`
+	MaxADC     *int     `json:"max_adc,omitempty"`
+	MinADC     *int     `json:"min_adc,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.LAS.Level
+type Level struct {
+	ADC   *int    `json:"adc,omitempty"`   // raw sensor threshold
+	Name  *string `json:"name,omitempty"`  // e.g., cloudy, overcast, dawn, twilight, total darkness, custom
+	Value *int    `json:"value,omitempty"` // brightness threshold (percent)
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.LAS.GetConfig
+type GetConfigMethod struct {
+	tpcommand.Method
+	Devs *[]Dev  `json:"devs,omitempty"`
+	Ver  *string `json:"ver,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.LAS.GetCurrentBrt
+type GetCurrentBrtMethod struct {
+	tpcommand.Method
+	Value *int `json:"value,omitempty"` // percent
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.LAS.SetBrtLevel
+type SetBrtLevelMethod struct {
+	tpcommand.Method
+	Index *int `json:"index,omitempty"` // into Dev.LevelArray
+	Value *int `json:"value,omitempty"` // percent
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.LAS.SetEnable
+type SetEnableMethod struct {
+	tpcommand.Method
+	Enable *int `json:"enable,omitempty"` // disabled (0), enabled (1)
+}
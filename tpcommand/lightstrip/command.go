@@ -0,0 +1,82 @@
+// Package lightstrip contains types for TP-Link light strips (e.g., KL400,
+// KL420, KL430), which are smart bulbs with individually addressable segments
+// and lighting effects.
+package lightstrip
+
+import (
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+)
+
+// HSV is a color as hue (0-360), saturation (0-100), and brightness (0-100).
+type HSV [3]int
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.light.lball.api.TPSmartBulbCommand
+// note: only the light strip modules are added since the rest is shared with smart bulbs
+type LightStripCommand struct {
+	smartbulb.SmartBulbCommand
+	LightStrip     *LightStripModule     `json:"smartlife.iot.lightStrip,omitempty"`
+	LightingEffect *LightingEffectModule `json:"smartlife.iot.lighting_effect,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.light.lball.api.TPSmartBulbCommand.LightingEffect.Effect
+type Effect struct {
+	Backgrounds       *[]HSV  `json:"backgrounds,omitempty"` // for random effects
+	Brightness        *int    `json:"brightness,omitempty"`
+	BrightnessRange   *[]int  `json:"brightness_range,omitempty"` // min, max; for random effects
+	Custom            *int    `json:"custom,omitempty"`           // preset (0), user-defined (1)
+	Direction         *int    `json:"direction,omitempty"`        // for sequence effects
+	Duration          *int    `json:"duration,omitempty"`         // milliseconds, or 0 for no limit
+	Enable            *int    `json:"enable,omitempty"`
+	ExpansionStrategy *int    `json:"expansion_strategy,omitempty"`
+	FadeOff           *int    `json:"fadeoff,omitempty"`   // milliseconds; for random effects
+	HueRange          *[]int  `json:"hue_range,omitempty"` // min, max; for random effects
+	ID                *string `json:"id,omitempty"`
+	InitStates        *[]HSV  `json:"init_states,omitempty"` // for random effects
+	Name              *string `json:"name,omitempty"`
+	RandomSeed        *int    `json:"random_seed,omitempty"`      // for random effects
+	RepeatTimes       *int    `json:"repeat_times,omitempty"`     // for sequence effects, or 0 for no limit
+	SaturationRange   *[]int  `json:"saturation_range,omitempty"` // min, max; for random effects
+	Segments          *[]int  `json:"segments,omitempty"`         // segments the effect applies to
+	Sequence          *[]HSV  `json:"sequence,omitempty"`         // for sequence effects
+	Spread            *int    `json:"spread,omitempty"`           // for sequence effects
+	Transition        *int    `json:"transition,omitempty"`       // milliseconds
+	TransitionRange   *[]int  `json:"transition_range,omitempty"` // min, max milliseconds; for random effects
+	Type              *string `json:"type,omitempty"`             // sequence, random
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.light.lball.api.TPSmartBulbCommand.LightingEffect
+type LightingEffectModule struct {
+	tpcommand.Module
+	SetLightingEffect *SetLightingEffectMethod `json:"set_lighting_effect,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.light.lball.api.TPSmartBulbCommand.LightingEffect.SetLightingEffect
+type SetLightingEffectMethod struct {
+	tpcommand.Method
+	Effect
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.light.lball.api.TPSmartBulbCommand.LightStrip
+type LightStripModule struct {
+	tpcommand.Module
+	GetLightState *GetLightStateMethod `json:"get_light_state,omitempty"`
+	SetLightState *SetLightStateMethod `json:"set_light_state,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.light.lball.api.TPSmartBulbCommand.LightStrip.GetLightState
+type GetLightStateMethod struct {
+	tpcommand.Method
+	DftOnState *smartbulb.LightState `json:"dft_on_state,omitempty"`
+	Length     *int                  `json:"length,omitempty"`
+	smartbulb.LightState
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.light.lball.api.TPSmartBulbCommand.LightStrip.SetLightState
+type SetLightStateMethod struct {
+	tpcommand.Method
+	HSV              *[]HSV `json:"hsv,omitempty"`      // color for each of Segments
+	Segments         *[]int `json:"segments,omitempty"` // segments to set
+	TransitionPeriod *int   `json:"transition_period,omitempty"`
+	smartbulb.LightState
+}
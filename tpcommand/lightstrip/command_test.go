@@ -0,0 +1,147 @@
+package lightstrip
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/kasa/tpcommand"
+)
+
+func TestPresets(t *testing.T) {
+	ids := map[string]string{}
+	for _, n := range PresetNames() {
+		e, ok := Preset(n)
+		if !ok {
+			t.Fatalf("%s: missing", n)
+		}
+		if e.Name == nil || *e.Name != n || e.ID == nil || e.Type == nil || e.Custom == nil || *e.Custom != 0 {
+			t.Errorf("%s: incorrect preset %#v", n, e)
+		}
+		if err := checkPreset(e); err != nil {
+			t.Errorf("%s: invalid preset: %v", n, err)
+		}
+		if x, ok := ids[*e.ID]; ok {
+			t.Errorf("%s: duplicate id (also used by %s)", n, x)
+		}
+		ids[*e.ID] = n
+
+		dec := json.NewDecoder(strings.NewReader(presets[n]))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&Effect{}); err != nil {
+			t.Errorf("%s: preset has fields missing from Effect: %v", n, err)
+		}
+		buf, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", n, err)
+		}
+		if a, b := canonical(t, buf), canonical(t, []byte(presets[n])); a != b {
+			t.Errorf("%s: round trip changed preset: %s", n, a)
+		}
+	}
+
+	e, _ := Preset("Aurora")
+	*e.Brightness = 1
+	if f, _ := Preset("Aurora"); *f.Brightness != 100 {
+		t.Errorf("preset was modified")
+	}
+	if _, ok := Preset("Nonexistent"); ok {
+		t.Errorf("expected nonexistent preset to be missing")
+	}
+}
+
+// checkPreset checks that e has the fields required by its type, and that the
+// values are within the ranges accepted by the device.
+func checkPreset(e Effect) error {
+	if len(*e.ID) != 32 {
+		return fmt.Errorf("id %q is not 32 characters", *e.ID)
+	}
+	for _, x := range []struct {
+		Name string
+		V    *int
+		Min  int
+		Max  int
+	}{
+		{"brightness", e.Brightness, 1, 100},
+		{"enable", e.Enable, 1, 1},
+		{"expansion_strategy", e.ExpansionStrategy, 0, math.MaxInt32},
+		{"duration", e.Duration, 0, math.MaxInt32},
+		{"transition", e.Transition, 0, math.MaxInt32},
+	} {
+		if x.V == nil {
+			return fmt.Errorf("missing %s", x.Name)
+		}
+		if *x.V < x.Min || *x.V > x.Max {
+			return fmt.Errorf("%s %d out of range", x.Name, *x.V)
+		}
+	}
+	if e.Segments == nil || len(*e.Segments) == 0 {
+		return fmt.Errorf("missing segments")
+	}
+	var hsvs []HSV
+	switch *e.Type {
+	case "sequence":
+		if e.Sequence == nil || len(*e.Sequence) == 0 || e.Direction == nil || e.Spread == nil || e.RepeatTimes == nil {
+			return fmt.Errorf("missing sequence fields")
+		}
+		hsvs = append(hsvs, *e.Sequence...)
+	case "random":
+		if e.InitStates == nil || len(*e.InitStates) == 0 || e.HueRange == nil || e.SaturationRange == nil || e.BrightnessRange == nil {
+			return fmt.Errorf("missing random fields")
+		}
+		for _, r := range []*[]int{e.HueRange, e.SaturationRange, e.BrightnessRange, e.TransitionRange} {
+			if r != nil && (len(*r) != 2 || (*r)[0] > (*r)[1]) {
+				return fmt.Errorf("invalid range %v", *r)
+			}
+		}
+		hsvs = append(hsvs, *e.InitStates...)
+		if e.Backgrounds != nil {
+			hsvs = append(hsvs, *e.Backgrounds...)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", *e.Type)
+	}
+	for _, c := range hsvs {
+		if c[0] < 0 || c[0] > 360 || c[1] < 0 || c[1] > 100 || c[2] < 0 || c[2] > 100 {
+			return fmt.Errorf("invalid color %v", c)
+		}
+	}
+	return nil
+}
+
+// canonical re-encodes buf with sorted keys.
+func canonical(t *testing.T, buf []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(b)
+}
+
+func TestSetLightState(t *testing.T) {
+	buf, err := json.Marshal(LightStripCommand{
+		LightStrip: &LightStripModule{
+			SetLightState: &SetLightStateMethod{
+				Segments: &[]int{0, 1},
+				HSV:      &[]HSV{{0, 100, 100}, {240, 100, 50}},
+			},
+		},
+		LightingEffect: &LightingEffectModule{
+			SetLightingEffect: &SetLightingEffectMethod{
+				Effect: Effect{Enable: tpcommand.IntPtr(0)},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if exp := `{"smartlife.iot.lightStrip":{"set_light_state":{"hsv":[[0,100,100],[240,100,50]],"segments":[0,1]}},"smartlife.iot.lighting_effect":{"set_lighting_effect":{"enable":0}}}`; string(buf) != exp {
+		t.Errorf("expected %s, got %s", exp, buf)
+	}
+}
@@ -0,0 +1,42 @@
+package lightstrip
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// presets contains the definitions of the built-in effects.
+//
+// note: this is incomplete and hasn't been verified against captures from the
+// app yet; the rest of the catalogue (e.g., Valentines, Ocean, Rainbow) is
+// missing
+var presets = map[string]string{
+	"Aurora":            `{"custom":0,"id":"xqUxDhbAhNLqulcuRMyPBmVGyTOyEMEu","brightness":100,"name":"Aurora","segments":[0],"expansion_strategy":1,"enable":1,"type":"sequence","duration":0,"transition":1500,"direction":4,"spread":7,"repeat_times":0,"sequence":[[120,100,100],[240,100,100],[260,100,100],[280,100,100]]}`,
+	"Bubbling Cauldron": `{"custom":0,"id":"tIwTRQBqJpeNKbrtBMFCgkdPTbAQGfRP","brightness":100,"name":"Bubbling Cauldron","segments":[0],"expansion_strategy":1,"enable":1,"type":"random","hue_range":[100,270],"saturation_range":[80,100],"brightness_range":[50,100],"duration":0,"transition":200,"init_states":[[270,100,100]],"fadeoff":1000,"random_seed":24,"backgrounds":[[270,40,50]]}`,
+	"Candy Cane":        `{"custom":0,"id":"HCOttllMkNffeHjEOLEgrFJjbzQHoxEJ","brightness":100,"name":"Candy Cane","segments":[0,1,2,3,4,5,6,7,8,9],"expansion_strategy":1,"enable":1,"type":"sequence","duration":0,"transition":200,"direction":1,"spread":1,"repeat_times":0,"sequence":[[0,0,100],[0,0,100],[360,81,100],[0,0,100],[0,0,100],[360,81,100],[360,81,100],[0,0,100],[0,0,100],[360,81,100],[360,81,100],[360,81,100],[360,81,100],[0,0,100],[0,0,100],[360,81,100]]}`,
+	"Christmas":         `{"custom":0,"id":"bwTatyinOUajKrDwzMmqxxJdnInQUgvM","brightness":100,"name":"Christmas","segments":[0],"expansion_strategy":1,"enable":1,"type":"random","hue_range":[136,146],"saturation_range":[90,100],"brightness_range":[50,100],"duration":5000,"transition":0,"init_states":[[136,0,100]],"fadeoff":2000,"random_seed":100,"backgrounds":[[136,98,75],[136,0,0],[350,0,100],[350,97,94]]}`,
+	"Flicker":           `{"custom":0,"id":"bCTItKETDFfrKANolgldxfgOakaarARs","brightness":100,"name":"Flicker","segments":[1],"expansion_strategy":1,"enable":1,"type":"random","hue_range":[30,40],"saturation_range":[100,100],"brightness_range":[50,100],"duration":0,"transition":0,"transition_range":[375,500],"init_states":[[30,81,80]]}`,
+}
+
+// Preset returns a copy of the built-in effect with the specified name.
+func Preset(name string) (Effect, bool) {
+	var e Effect
+	p, ok := presets[name]
+	if !ok {
+		return e, false
+	}
+	if err := json.Unmarshal([]byte(p), &e); err != nil {
+		panic(err)
+	}
+	return e, true
+}
+
+// PresetNames returns the names of the built-in effects in lexical order.
+func PresetNames() []string {
+	ns := make([]string, 0, len(presets))
+	for n := range presets {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
@@ -0,0 +1,45 @@
+// Package pir contains types for the motion (passive infrared) sensor of
+// TP-Link switches (e.g., KS220M).
+package pir
+
+import "github.com/pgaskin/kasa/tpcommand"
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.PIR
+type PIRModule struct {
+	tpcommand.Module
+	GetConfig      *GetConfigMethod      `json:"get_config,omitempty"`
+	SetColdTime    *SetColdTimeMethod    `json:"set_cold_time,omitempty"`
+	SetEnable      *SetEnableMethod      `json:"set_enable,omitempty"`
+	SetTriggerSens *SetTriggerSensMethod `json:"set_trigger_sens,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.PIR.GetConfig
+type GetConfigMethod struct {
+	tpcommand.Method
+	Array        *[]int  `json:"array,omitempty"`         // sensitivity threshold for each trigger index
+	ColdTime     *int    `json:"cold_time,omitempty"`     // milliseconds without motion before the switch turns off
+	Enable       *int    `json:"enable,omitempty"`        // disabled (0), enabled (1)
+	MaxADC       *int    `json:"max_adc,omitempty"`       // maximum raw sensor value
+	MinADC       *int    `json:"min_adc,omitempty"`       // minimum raw sensor value
+	TriggerIndex *int    `json:"trigger_index,omitempty"` // far (0), mid (1), near (2), custom (3)
+	Version      *string `json:"version,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.PIR.SetColdTime
+type SetColdTimeMethod struct {
+	tpcommand.Method
+	ColdTime *int `json:"cold_time,omitempty"` // milliseconds
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.PIR.SetEnable
+type SetEnableMethod struct {
+	tpcommand.Method
+	Enable *int `json:"enable,omitempty"` // disabled (0), enabled (1)
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.PIR.SetTriggerSens
+type SetTriggerSensMethod struct {
+	tpcommand.Method
+	Index *int `json:"index,omitempty"` // far (0), mid (1), near (2), custom (3)
+	Value *int `json:"value,omitempty"` // threshold, for custom
+}
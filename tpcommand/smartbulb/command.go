@@ -390,6 +390,7 @@ type GetSysInfoMethod struct {
 	IsColor             *int                 `json:"is_color,omitempty"`
 	IsDimmable          *int                 `json:"is_dimmable,omitempty"`
 	IsVariableColorTemp *int                 `json:"is_variable_color_temp,omitempty"`
+	Length              *int                 `json:"length,omitempty"` // for light strips, the number of segments
 	LightState          *LightState          `json:"light_state,omitempty"`
 	LightingEffectState *LightingEffectState `json:"lighting_effect_state,omitempty"`
 	MicMac              *string              `json:"mic_mac,omitempty"`
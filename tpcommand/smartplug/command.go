@@ -0,0 +1,431 @@
+// Package smartplug contains types for TP-Link smart plugs.
+package smartplug
+
+import (
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/device"
+	"github.com/pgaskin/kasa/tpcommand/emeter"
+)
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Rule
+type Rule struct {
+	Day      *int    `json:"day,omitempty"`
+	EAct     *int    `json:"eact,omitempty"`
+	EMin     *int    `json:"emin,omitempty"`
+	Enable   *int    `json:"enable,omitempty"`
+	EOffset  *int    `json:"eoffset,omitempty"`
+	ETimeOpt *int    `json:"etime_opt,omitempty"`
+	ID       *string `json:"id,omitempty"`
+	Month    *int    `json:"month,omitempty"`
+	Name     *string `json:"name,omitempty"`
+	Remain   *int    `json:"remain,omitempty"`
+	Repeat   *int    `json:"repeat,omitempty"`
+	SAct     *int    `json:"sact,omitempty"` // off (0), on (1)
+	SMin     *int    `json:"smin,omitempty"` // minutes relative to STimeOpt
+	SOffset  *int    `json:"soffset,omitempty"`
+	STimeOpt *int    `json:"stime_opt,omitempty"` // none (-1), midnight (0), sunrise (1), sunset (2)
+	Wday     *[]int  `json:"wday,omitempty"`
+	Year     *int    `json:"year,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.CountDownRule
+type CountDownRule struct {
+	Act    *int    `json:"act,omitempty"`   // off (0), on (1)
+	Delay  *int    `json:"delay,omitempty"` // seconds
+	Enable *int    `json:"enable,omitempty"`
+	ID     *string `json:"id,omitempty"`
+	Name   *string `json:"name,omitempty"`
+	Remain *int    `json:"remain,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheftRule
+type AntiTheftRule struct {
+	Day       *int    `json:"day,omitempty"`
+	Duration  *int    `json:"duration,omitempty"`
+	EMin      *int    `json:"emin,omitempty"`
+	Enable    *int    `json:"enable,omitempty"`
+	EOffset   *int    `json:"eoffset,omitempty"`
+	ETimeOpt  *int    `json:"etime_opt,omitempty"`
+	Frequency *int    `json:"frequency,omitempty"`
+	ID        *string `json:"id,omitempty"`
+	LastFor   *int    `json:"lastfor,omitempty"`
+	Month     *int    `json:"month,omitempty"`
+	Name      *string `json:"name,omitempty"`
+	Repeat    *int    `json:"repeat,omitempty"`
+	SMin      *int    `json:"smin,omitempty"`
+	SOffset   *int    `json:"soffset,omitempty"`
+	STimeOpt  *int    `json:"stime_opt,omitempty"`
+	Wday      *[]int  `json:"wday,omitempty"`
+	Year      *int    `json:"year,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Time
+// note: extracted for reuse since Go can do struct composition
+type Time struct {
+	Hour  *int `json:"hour,omitempty"`
+	Mday  *int `json:"mday,omitempty"`
+	Min   *int `json:"min,omitempty"`
+	Month *int `json:"month,omitempty"`
+	Sec   *int `json:"sec,omitempty"`
+	Year  *int `json:"year,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand
+// note: System shadows device.DeviceCommand.System, but embeds it
+type SmartPlugCommand struct {
+	device.DeviceCommand
+	AntiTheft *AntiTheftModule     `json:"anti_theft,omitempty"`
+	Cloud     *CloudModule         `json:"cnCloud,omitempty"`
+	CountDown *CountDownModule     `json:"count_down,omitempty"`
+	Emeter    *emeter.EmeterModule `json:"emeter,omitempty"`
+	NetIf     *NetIfModule         `json:"netif,omitempty"`
+	Schedule  *ScheduleModule      `json:"schedule,omitempty"`
+	System    *SystemModule        `json:"system,omitempty"`
+	Time      *TimeModule          `json:"time,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheft
+type AntiTheftModule struct {
+	tpcommand.Module
+	AddRule          *AntiTheftAddRuleMethod  `json:"add_rule,omitempty"`
+	DeleteAllRules   *DeleteAllRulesMethod    `json:"delete_all_rules,omitempty"`
+	DeleteRule       *DeleteRuleMethod        `json:"delete_rule,omitempty"`
+	EditRule         *AntiTheftEditRuleMethod `json:"edit_rule,omitempty"`
+	GetRules         *AntiTheftGetRulesMethod `json:"get_rules,omitempty"`
+	SetOverallEnable *SetOverallEnableMethod  `json:"set_overall_enable,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheft.AddRule
+type AntiTheftAddRuleMethod struct {
+	tpcommand.Method
+	AntiTheftRule
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheft.EditRule
+type AntiTheftEditRuleMethod struct {
+	tpcommand.Method
+	AntiTheftRule
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheft.GetRules
+type AntiTheftGetRulesMethod struct {
+	tpcommand.Method
+	Enable   *int             `json:"enable,omitempty"`
+	RuleList *[]AntiTheftRule `json:"rule_list,omitempty"`
+	Version  *int             `json:"version,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Cloud
+type CloudModule struct {
+	tpcommand.Module
+	Bind          *BindMethod          `json:"bind,omitempty"`
+	GetInfo       *GetInfoMethod       `json:"get_info,omitempty"`
+	GetIntlFwList *GetIntlFwListMethod `json:"get_intl_fw_list,omitempty"`
+	SetServerURL  *SetServerURLMethod  `json:"set_server_url,omitempty"`
+	Unbind        *UnbindMethod        `json:"unbind,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Cloud.Bind
+type BindMethod struct {
+	tpcommand.Method
+	Password *string `json:"password,omitempty"`
+	Username *string `json:"username,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Cloud.GetInfo
+type GetInfoMethod struct {
+	tpcommand.Method
+	Binded       *int    `json:"binded,omitempty"`
+	CldCnnection *int    `json:"cld_connection,omitempty"`
+	FwDlPage     *string `json:"fwDlPage,omitempty"`
+	FwNotifyType *int    `json:"fwNotifyType,omitempty"`
+	IllegalType  *int    `json:"illegalType,omitempty"`
+	Server       *string `json:"server,omitempty"`
+	StopConnect  *int    `json:"stopConnect,omitempty"`
+	TcspInfo     *string `json:"tcspInfo,omitempty"`
+	TcspStatus   *int    `json:"tcspStatus,omitempty"`
+	Username     *string `json:"username,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Cloud.GetIntlFwList
+type GetIntlFwListMethod struct {
+	tpcommand.Method
+	FwList *[]map[string]interface{} `json:"fw_list,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Cloud.SetServerURL
+type SetServerURLMethod struct {
+	tpcommand.Method
+	Server *string `json:"server,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Cloud.Unbind
+type UnbindMethod struct {
+	tpcommand.Method
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.CountDown
+type CountDownModule struct {
+	tpcommand.Module
+	AddRule        *CountDownAddRuleMethod  `json:"add_rule,omitempty"`
+	DeleteAllRules *DeleteAllRulesMethod    `json:"delete_all_rules,omitempty"`
+	DeleteRule     *DeleteRuleMethod        `json:"delete_rule,omitempty"`
+	EditRule       *CountDownEditRuleMethod `json:"edit_rule,omitempty"`
+	GetRules       *CountDownGetRulesMethod `json:"get_rules,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.CountDown.AddRule
+type CountDownAddRuleMethod struct {
+	tpcommand.Method
+	CountDownRule
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.CountDown.EditRule
+type CountDownEditRuleMethod struct {
+	tpcommand.Method
+	CountDownRule
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.CountDown.GetRules
+type CountDownGetRulesMethod struct {
+	tpcommand.Method
+	RuleList *[]CountDownRule `json:"rule_list,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.NetIf
+type NetIfModule struct {
+	tpcommand.Module
+	GetScanInfo *GetScanInfoMethod `json:"get_scaninfo,omitempty"`
+	GetStaInfo  *GetStaInfoMethod  `json:"get_stainfo,omitempty"`
+	SetStaInfo  *SetStaInfoMethod  `json:"set_stainfo,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.NetIf.AP
+type AP struct {
+	KeyType *int    `json:"key_type,omitempty"`
+	SSID    *string `json:"ssid,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.NetIf.GetScanInfo
+type GetScanInfoMethod struct {
+	tpcommand.Method
+	ApList  *[]AP `json:"ap_list,omitempty"`
+	Refresh *int  `json:"refresh,omitempty"`
+	Timeout *int  `json:"timeout,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.NetIf.GetStaInfo
+type GetStaInfoMethod struct {
+	tpcommand.Method
+	KeyType *int    `json:"key_type,omitempty"`
+	RSSI    *int    `json:"rssi,omitempty"`
+	SSID    *string `json:"ssid,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.NetIf.SetStaInfo
+type SetStaInfoMethod struct {
+	tpcommand.Method
+	KeyType  *int    `json:"key_type,omitempty"`
+	Password *string `json:"password,omitempty"`
+	SSID     *string `json:"ssid,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule
+type ScheduleModule struct {
+	tpcommand.Module
+	AddRule          *AddRuleMethod          `json:"add_rule,omitempty"`
+	DeleteAllRules   *DeleteAllRulesMethod   `json:"delete_all_rules,omitempty"`
+	DeleteRule       *DeleteRuleMethod       `json:"delete_rule,omitempty"`
+	EditRule         *EditRuleMethod         `json:"edit_rule,omitempty"`
+	EraseRuntimeStat *EraseRuntimeStatMethod `json:"erase_runtime_stat,omitempty"`
+	GetDayStat       *GetDayStatMethod       `json:"get_daystat,omitempty"`
+	GetMonthStat     *GetMonthStatMethod     `json:"get_monthstat,omitempty"`
+	GetNextAction    *GetNextActionMethod    `json:"get_next_action,omitempty"`
+	GetRules         *GetRulesMethod         `json:"get_rules,omitempty"`
+	SetOverallEnable *SetOverallEnableMethod `json:"set_overall_enable,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.AddRule
+type AddRuleMethod struct {
+	tpcommand.Method
+	ConflictID *string `json:"conflict_id,omitempty"`
+	Rule
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.DeleteAllRules
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.CountDown.DeleteAllRules
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheft.DeleteAllRules
+type DeleteAllRulesMethod struct {
+	tpcommand.Method
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.DeleteRule
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.CountDown.DeleteRule
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheft.DeleteRule
+type DeleteRuleMethod struct {
+	tpcommand.Method
+	ID *string `json:"id,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.EditRule
+type EditRuleMethod struct {
+	tpcommand.Method
+	ConflictID *string `json:"conflict_id,omitempty"`
+	Rule
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.EraseRuntimeStat
+type EraseRuntimeStatMethod struct {
+	tpcommand.Method
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.GetDayStat
+type GetDayStatMethod struct {
+	tpcommand.Method
+	DayList *[]map[string]interface{} `json:"day_list,omitempty"`
+	Month   *int                      `json:"month,omitempty"`
+	Year    *int                      `json:"year,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.GetMonthStat
+type GetMonthStatMethod struct {
+	tpcommand.Method
+	MonthList *[]map[string]interface{} `json:"month_list,omitempty"`
+	Year      *int                      `json:"year,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.GetNextAction
+type GetNextActionMethod struct {
+	tpcommand.Method
+	Action   *int    `json:"action,omitempty"`
+	ID       *string `json:"id,omitempty"`
+	SchdTime *int    `json:"schd_time,omitempty"`
+	Type     *int    `json:"type,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.GetRules
+type GetRulesMethod struct {
+	tpcommand.Method
+	Enable   *int    `json:"enable,omitempty"`
+	RuleList *[]Rule `json:"rule_list,omitempty"`
+	Version  *int    `json:"version,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Schedule.SetOverallEnable
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.AntiTheft.SetOverallEnable
+type SetOverallEnableMethod struct {
+	tpcommand.Method
+	Enable *int `json:"enable,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System
+type SystemModule struct {
+	device.SystemModule
+	GetSysInfo     *GetSysInfoMethod     `json:"get_sysinfo,omitempty"`
+	SetDevLocation *SetDevLocationMethod `json:"set_dev_location,omitempty"`
+	SetLEDOff      *SetLEDOffMethod      `json:"set_led_off,omitempty"`
+	SetMACAddr     *SetMACAddrMethod     `json:"set_mac_addr,omitempty"`
+	SetRelayState  *SetRelayStateMethod  `json:"set_relay_state,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System.GetSysInfo
+type GetSysInfoMethod struct {
+	tpcommand.Method
+	ActiveMode *string     `json:"active_mode,omitempty"`
+	Alias      *string     `json:"alias,omitempty"`
+	Brightness *int        `json:"brightness,omitempty"` // for dimmers
+	ChildNum   *int        `json:"child_num,omitempty"`  // for power strips
+	Children   *[]Child    `json:"children,omitempty"`   // for power strips
+	DevName    *string     `json:"dev_name,omitempty"`
+	DeviceID   *string     `json:"deviceId,omitempty"`
+	Feature    *string     `json:"feature,omitempty"` // e.g., TIM (timer), ENE (energy meter)
+	FwID       *string     `json:"fwId,omitempty"`
+	HwID       *string     `json:"hwId,omitempty"`
+	HwVer      *string     `json:"hw_ver,omitempty"`
+	IconHash   *string     `json:"icon_hash,omitempty"`
+	LatitudeI  *int        `json:"latitude_i,omitempty"`  // latitude * 10000
+	LEDOff     *int        `json:"led_off,omitempty"`     // whether the LED is off
+	LongitudeI *int        `json:"longitude_i,omitempty"` // longitude * 10000
+	MAC        *string     `json:"mac,omitempty"`
+	MicType    *string     `json:"mic_type,omitempty"`
+	Model      *string     `json:"model,omitempty"`
+	NextAction *NextAction `json:"next_action,omitempty"`
+	OemID      *string     `json:"oemId,omitempty"`
+	OnTime     *int        `json:"on_time,omitempty"`     // seconds since the relay was turned on
+	RelayState *int        `json:"relay_state,omitempty"` // off (0), on (1)
+	RSSI       *int        `json:"rssi,omitempty"`
+	SwVer      *string     `json:"sw_ver,omitempty"`
+	Type       *string     `json:"type,omitempty"`
+	Updating   *int        `json:"updating,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System.GetSysInfo.Child
+type Child struct {
+	Alias      *string     `json:"alias,omitempty"`
+	ID         *string     `json:"id,omitempty"` // for use in device.ContextModule.ChildIDs
+	NextAction *NextAction `json:"next_action,omitempty"`
+	OnTime     *int        `json:"on_time,omitempty"`
+	State      *int        `json:"state,omitempty"` // off (0), on (1)
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System.GetSysInfo.NextAction
+type NextAction struct {
+	Action  *int    `json:"action,omitempty"`
+	ID      *string `json:"id,omitempty"`
+	SchdSec *int    `json:"schd_sec,omitempty"`
+	Type    *int    `json:"type,omitempty"` // none (-1), schedule (1), countdown (2)
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System.SetDevLocation
+type SetDevLocationMethod struct {
+	tpcommand.Method
+	Latitude   *float64 `json:"latitude,omitempty"`
+	LatitudeI  *int     `json:"latitude_i,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+	LongitudeI *int     `json:"longitude_i,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System.SetLEDOff
+type SetLEDOffMethod struct {
+	tpcommand.Method
+	Off *int `json:"off,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System.SetMACAddr
+type SetMACAddrMethod struct {
+	tpcommand.Method
+	MAC *string `json:"mac,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.System.SetRelayState
+type SetRelayStateMethod struct {
+	tpcommand.Method
+	State *int `json:"state,omitempty"` // off (0), on (1)
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Time
+type TimeModule struct {
+	tpcommand.Module
+	GetTime     *GetTimeMethod     `json:"get_time,omitempty"`
+	GetTimeZone *GetTimeZoneMethod `json:"get_timezone,omitempty"`
+	SetTimeZone *SetTimeZoneMethod `json:"set_timezone,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Time.GetTime
+type GetTimeMethod struct {
+	tpcommand.Method
+	Time
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Time.GetTimeZone
+type GetTimeZoneMethod struct {
+	tpcommand.Method
+	Index *int `json:"index,omitempty"`
+}
+
+// com.tplink.kasa_android@2.35.0.1021/com.tplinkra.smartplug.api.TPSmartPlugCommand.Time.SetTimeZone
+type SetTimeZoneMethod struct {
+	tpcommand.Method
+	Index *int `json:"index,omitempty"`
+	Time
+}
@@ -0,0 +1,53 @@
+package smartplug
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pgaskin/kasa/tpcommand"
+)
+
+func TestSmartPlugCommand(t *testing.T) {
+	// HS103(US) 1.0, firmware 1.0.4
+	const resp = `{"system":{"get_sysinfo":{"sw_ver":"1.0.4 Build 191111 Rel.143500","hw_ver":"1.0","model":"HS103(US)","deviceId":"8006C28A1E7B1EA0D2C1F8E6A0C1E7B1D2C1F8E6","oemId":"211C91F3C6FA93568D818524FA3BA42A","hwId":"B25D5316C4BE2C2E7C9E8BEE44AE1111","rssi":-52,"longitude_i":-1,"latitude_i":-1,"alias":"Lamp","status":"new","mic_type":"IOT.SMARTPLUGSWITCH","feature":"TIM","mac":"50:C7:BF:00:00:00","updating":0,"led_off":0,"relay_state":1,"on_time":3600,"icon_hash":"","dev_name":"Smart Wi-Fi Plug Mini","active_mode":"none","next_action":{"type":-1},"err_code":0},"set_dev_alias":{"err_code":0}}}`
+
+	var c SmartPlugCommand
+	if err := json.Unmarshal([]byte(resp), &c); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if c.System == nil || c.System.GetSysInfo == nil || c.System.SetDevAlias == nil {
+		t.Fatalf("missing system methods: %#v", c.System)
+	}
+	if s := c.System.GetSysInfo; s.CheckError() != nil || *s.Model != "HS103(US)" || *s.RelayState != 1 || *s.OnTime != 3600 || *s.LEDOff != 0 || *s.NextAction.Type != -1 {
+		t.Errorf("incorrect sysinfo %#v", s)
+	}
+
+	buf, err := json.Marshal(SmartPlugCommand{
+		System: &SystemModule{
+			SetRelayState: &SetRelayStateMethod{State: tpcommand.IntPtr(0)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if exp := `{"system":{"set_relay_state":{"state":0}}}`; string(buf) != exp {
+		t.Errorf("expected %s, got %s", exp, buf)
+	}
+}
+
+func TestSmartPlugCommandChildren(t *testing.T) {
+	// HS300(US) 1.0, firmware 1.0.21 (trimmed)
+	const resp = `{"system":{"get_sysinfo":{"sw_ver":"1.0.21 Build 210524 Rel.161309","hw_ver":"1.0","model":"HS300(US)","deviceId":"8006A0D2C1F8E6A0C1E7B1D2C1F8E6A0C1E7B1EA","alias":"Strip","mic_type":"IOT.SMARTPLUGSWITCH","feature":"TIM:ENE","child_num":2,"children":[{"id":"8006A0D2C1F8E6A0C1E7B1D2C1F8E6A0C1E7B1EA00","state":1,"alias":"Desk","on_time":120,"next_action":{"type":-1}},{"id":"8006A0D2C1F8E6A0C1E7B1D2C1F8E6A0C1E7B1EA01","state":0,"alias":"Fan","on_time":0,"next_action":{"type":-1}}],"err_code":0}}}`
+
+	var c SmartPlugCommand
+	if err := json.Unmarshal([]byte(resp), &c); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	s := c.System.GetSysInfo
+	if s.ChildNum == nil || *s.ChildNum != 2 || s.Children == nil || len(*s.Children) != 2 {
+		t.Fatalf("incorrect children %#v", s)
+	}
+	if ch := (*s.Children)[1]; *ch.ID != *s.DeviceID+"01" || *ch.State != 0 || *ch.Alias != "Fan" || *ch.NextAction.Type != -1 {
+		t.Errorf("incorrect child %#v", ch)
+	}
+}
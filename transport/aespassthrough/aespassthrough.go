@@ -0,0 +1,324 @@
+// Package aespassthrough implements the securePassthrough protocol used by
+// some TP-Link smart home devices, which wraps requests encrypted with an AES
+// key exchanged using RSA in JSON over HTTP on port 80.
+package aespassthrough
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/internal/expiry"
+	"github.com/pgaskin/kasa/transport"
+)
+
+const (
+	DevicePort    = 80
+	SessionCookie = "TP_SESSIONID"
+)
+
+// Error codes returned in the outer response, or for ErrCodeSessionExpired,
+// also the inner one.
+const (
+	ErrCodeSessionExpired = 9999
+	ErrCodeLoginFailed    = -1501
+)
+
+var (
+	DefaultTimeout        = time.Second * 10
+	DefaultSessionTimeout = time.Hour * 24
+	RSAKeyBits            = 1024
+)
+
+// ErrAuth is returned when the device rejects the credentials.
+var ErrAuth = errors.New("authentication failed")
+
+// Error is an error code returned by the device for a method.
+type Error struct {
+	Method string
+	Code   int
+}
+
+func (err Error) Error() string {
+	return fmt.Sprintf("securepassthrough %s: error_code %d", err.Method, err.Code)
+}
+
+type Client struct {
+	Addr       string // host, with an optional port
+	Username   string
+	Password   string
+	HTTPClient *http.Client // if nil, a client with DefaultTimeout is used
+
+	mu   sync.Mutex
+	sess *clientSession
+}
+
+type clientSession struct {
+	cookie  string
+	expires time.Time
+	cipher  *cipherState
+	token   string
+}
+
+// envelope is the outer JSON request.
+type envelope struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+// result is the outer JSON response.
+type result struct {
+	ErrorCode int             `json:"error_code"`
+	Result    json.RawMessage `json:"result,omitempty"`
+}
+
+var _ transport.ContextRequester = (*Client)(nil)
+
+func (c *Client) Request(in, out interface{}) error {
+	return c.RequestContext(context.Background(), in, out)
+}
+
+func (c *Client) RequestContext(ctx context.Context, in, out interface{}) error {
+	req, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var resp []byte
+	for retry := true; ; retry = false {
+		if c.sess == nil || time.Now().After(c.sess.expires) {
+			if c.sess, err = c.login(ctx); err != nil {
+				c.sess = nil
+				return err
+			}
+		}
+
+		if resp, err = c.passthrough(ctx, c.sess, req); err == nil {
+			break
+		}
+		if errors.Is(err, errSessionExpired) {
+			c.sess = nil
+			if retry {
+				continue
+			}
+		}
+		return err
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(resp, out); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+var errSessionExpired = errors.New("session expired")
+
+// login does the key exchange, then logs in to get a token.
+func (c *Client) login(ctx context.Context) (*clientSession, error) {
+	key, err := rsa.GenerateKey(rand.Reader, RSAKeyBits)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: generate key: %w", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: encode key: %w", err)
+	}
+
+	var hres struct {
+		Key string `json:"key"`
+	}
+	hresp, err := c.call(ctx, "", "", envelope{
+		Method: "handshake",
+		Params: map[string]interface{}{
+			"key":             string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+			"requestTimeMils": 0,
+		},
+	}, &hres)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+
+	enc, err := base64.StdEncoding.DecodeString(hres.Key)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: decode key: %w", err)
+	}
+	kiv, err := rsa.DecryptPKCS1v15(rand.Reader, key, enc)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: decrypt key: %w", err)
+	}
+	if len(kiv) != 32 {
+		return nil, fmt.Errorf("handshake: invalid key length %d", len(kiv))
+	}
+
+	sess := &clientSession{
+		expires: time.Now().Add(DefaultSessionTimeout),
+		cipher:  &cipherState{key: kiv[:16], iv: kiv[16:]},
+	}
+	for _, ck := range hresp.Cookies() {
+		switch ck.Name {
+		case SessionCookie:
+			sess.cookie = ck.Value
+		case "TIMEOUT":
+			if n, err := strconv.Atoi(ck.Value); err == nil && n > 0 {
+				sess.expires = expiry.Time(time.Duration(n) * time.Second)
+			}
+		}
+	}
+	if sess.cookie == "" {
+		return nil, fmt.Errorf("handshake: missing session cookie")
+	}
+
+	h := sha1.Sum([]byte(c.Username))
+	lreq, err := json.Marshal(map[string]interface{}{
+		"method": "login_device",
+		"params": map[string]interface{}{
+			"username": base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString(h[:]))),
+			"password": base64.StdEncoding.EncodeToString([]byte(c.Password)),
+		},
+		"request_time_milis": time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("login: encode request: %w", err)
+	}
+
+	lresp, err := c.passthrough(ctx, sess, lreq)
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+
+	var lres struct {
+		ErrorCode int `json:"error_code"`
+		Result    struct {
+			Token string `json:"token"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(lresp, &lres); err != nil {
+		return nil, fmt.Errorf("login: parse response: %w", err)
+	}
+	if lres.ErrorCode == ErrCodeLoginFailed {
+		return nil, fmt.Errorf("login: %w", ErrAuth)
+	}
+	if lres.ErrorCode != 0 {
+		return nil, fmt.Errorf("login: %w", Error{"login_device", lres.ErrorCode})
+	}
+	if lres.Result.Token == "" {
+		return nil, fmt.Errorf("login: missing token")
+	}
+	sess.token = lres.Result.Token
+
+	return sess, nil
+}
+
+// passthrough sends an encrypted request.
+func (c *Client) passthrough(ctx context.Context, sess *clientSession, req []byte) ([]byte, error) {
+	var res struct {
+		Response string `json:"response"`
+	}
+	if _, err := c.call(ctx, sess.cookie, sess.token, envelope{
+		Method: "securePassthrough",
+		Params: map[string]string{
+			"request": base64.StdEncoding.EncodeToString(sess.cipher.encrypt(req)),
+		},
+	}, &res); err != nil {
+		return nil, err
+	}
+
+	enc, err := base64.StdEncoding.DecodeString(res.Response)
+	if err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	resp, err := sess.cipher.decrypt(enc)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt response: %w", err)
+	}
+
+	// when the token expires, the error may be in the inner response instead
+	var inner struct {
+		ErrorCode int `json:"error_code"`
+	}
+	if json.Unmarshal(resp, &inner) == nil && inner.ErrorCode == ErrCodeSessionExpired {
+		return nil, errSessionExpired
+	}
+	return resp, nil
+}
+
+// call makes an outer request, checks the error code, and decodes the result.
+func (c *Client) call(ctx context.Context, cookie, token string, env envelope, out interface{}) (*http.Response, error) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	host := c.Addr
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, strconv.Itoa(DevicePort))
+	}
+
+	u := "http://" + host + "/app"
+	if token != "" {
+		u += "?token=" + token
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookie, Value: cookie})
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, errSessionExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("send request: response status %s", resp.Status)
+	}
+
+	var res result
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<24)).Decode(&res); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if res.ErrorCode == ErrCodeSessionExpired {
+		return nil, errSessionExpired
+	}
+	if res.ErrorCode != 0 {
+		return nil, Error{env.Method, res.ErrorCode}
+	}
+	if err := json.Unmarshal(res.Result, out); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,278 @@
+package aespassthrough
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/sim"
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+)
+
+func TestClient(t *testing.T) {
+	s := &Server{
+		Username: "user@example.com",
+		Password: "password",
+		Handler:  sim.NewBulb(sim.Profiles["KL130"]),
+	}
+	var handshakes, tokens int32
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") == "" {
+			atomic.AddInt32(&handshakes, 1)
+		}
+		if r.URL.Query().Get("token") != "" {
+			atomic.AddInt32(&tokens, 1)
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer hs.Close()
+
+	c := &Client{
+		Addr:     strings.TrimPrefix(hs.URL, "http://"),
+		Username: "user@example.com",
+		Password: "password",
+	}
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			s.Expire()
+		}
+		var resp smartbulb.SmartBulbCommand
+		if err := c.Request(smartbulb.SmartBulbCommand{
+			LightingService: &smartbulb.LightingServiceModule{
+				TransitionLightState: &smartbulb.TransitionLightStateMethod{
+					LightState: smartbulb.LightState{Hue: tpcommand.IntPtr(10 + i)},
+				},
+			},
+		}, &resp); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if m := resp.LightingService.TransitionLightState; m.CheckError() != nil || *m.Hue != 10+i {
+			t.Errorf("request %d: incorrect response", i)
+		}
+	}
+	// the third request is rejected with the outer error code since the
+	// session expired, then it is retried after a new handshake and login
+	if n := atomic.LoadInt32(&handshakes); n != 2 {
+		t.Errorf("expected 2 handshakes, got %d", n)
+	}
+	if n := atomic.LoadInt32(&tokens); n != 4 {
+		t.Errorf("expected the token to be sent with 4 requests, got %d", n)
+	}
+
+	c = &Client{
+		Addr:     c.Addr,
+		Username: "user@example.com",
+		Password: "wrong",
+	}
+	if err := c.Request(struct{}{}, nil); !errors.Is(err, ErrAuth) {
+		t.Errorf("expected auth error, got %v", err)
+	}
+}
+
+func TestClientTokenExpired(t *testing.T) {
+	s := &Server{
+		Username: "user@example.com",
+		Password: "password",
+		Handler:  sim.NewBulb(sim.Profiles["KL130"]),
+	}
+	var logins int32
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") == "" && r.Header.Get("Cookie") != "" {
+			atomic.AddInt32(&logins, 1)
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer hs.Close()
+
+	c := &Client{
+		Addr:     strings.TrimPrefix(hs.URL, "http://"),
+		Username: "user@example.com",
+		Password: "password",
+	}
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			s.ExpireTokens()
+		}
+		var resp smartbulb.SmartBulbCommand
+		if err := c.Request(smartbulb.SmartBulbCommand{
+			SysInfo: &smartbulb.SysInfoModule{GetSysInfo: &smartbulb.GetSysInfoMethod{}},
+		}, &resp); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if resp.SysInfo == nil || resp.SysInfo.GetSysInfo == nil {
+			t.Errorf("request %d: incorrect response", i)
+		}
+	}
+	if n := atomic.LoadInt32(&logins); n != 2 {
+		t.Errorf("expected 2 logins, got %d", n)
+	}
+}
+
+func TestClientShortTimeout(t *testing.T) {
+	s := &Server{
+		Username:       "user@example.com",
+		Password:       "password",
+		SessionTimeout: time.Second * 30,
+		Handler:        sim.NewBulb(sim.Profiles["KL130"]),
+	}
+	var handshakes int32
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") == "" {
+			atomic.AddInt32(&handshakes, 1)
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer hs.Close()
+
+	c := &Client{
+		Addr:     strings.TrimPrefix(hs.URL, "http://"),
+		Username: "user@example.com",
+		Password: "password",
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.Request(struct{}{}, nil); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&handshakes); n != 1 {
+		t.Errorf("expected session to be reused, got %d handshakes", n)
+	}
+}
+
+// The vectors below were computed separately with OpenSSL and Python's
+// hashlib, following python-kasa's AesEncyptionSession and AesTransport.
+var testKeyIV = mustHex("202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f")
+
+func TestCipher(t *testing.T) {
+	c := &cipherState{key: testKeyIV[:16], iv: testKeyIV[16:]}
+	for _, tc := range []struct {
+		Msg string
+		CT  string
+	}{
+		{`{"system":{"get_sysinfo":{}}}`, "cY/bZdvMs55SVsWY9/0EYP6w4iwxQnimiGjjbXHnAOQ="},
+		{`{"method":"get_device_info"}`, "m8O3wZ6PDSH482tQaDMTFG6E1e1PnvvmWJ806G5dY5c="},
+	} {
+		ct := c.encrypt([]byte(tc.Msg))
+		if x := base64.StdEncoding.EncodeToString(ct); x != tc.CT {
+			t.Errorf("encrypt %q: expected %s, got %s", tc.Msg, tc.CT, x)
+		}
+		if pt, err := c.decrypt(ct); err != nil {
+			t.Errorf("decrypt %q: %v", tc.Msg, err)
+		} else if string(pt) != tc.Msg {
+			t.Errorf("decrypt %q: got %q", tc.Msg, pt)
+		}
+	}
+	if _, err := c.decrypt(make([]byte, 15)); err == nil {
+		t.Errorf("decrypt: expected error for truncated ciphertext")
+	}
+}
+
+// TestLogin checks the client against a fake device which uses a fixed key and
+// IV, and checks the encoding of the credentials.
+func TestLogin(t *testing.T) {
+	c := &cipherState{key: testKeyIV[:16], iv: testKeyIV[16:]}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var env struct {
+			Method string `json:"method"`
+			Params struct {
+				Key     string `json:"key"`
+				Request string `json:"request"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+			t.Errorf("decode request: %v", err)
+			return
+		}
+		switch env.Method {
+		case "handshake":
+			b, _ := pem.Decode([]byte(env.Params.Key))
+			if b == nil {
+				t.Errorf("handshake: invalid key")
+				return
+			}
+			k, err := x509.ParsePKIXPublicKey(b.Bytes)
+			if err != nil {
+				t.Errorf("handshake: parse key: %v", err)
+				return
+			}
+			enc, err := rsa.EncryptPKCS1v15(rand.Reader, k.(*rsa.PublicKey), testKeyIV)
+			if err != nil {
+				t.Errorf("handshake: encrypt key: %v", err)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: "test"})
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 0, "result": map[string]string{"key": base64.StdEncoding.EncodeToString(enc)}})
+		case "securePassthrough":
+			ct, _ := base64.StdEncoding.DecodeString(env.Params.Request)
+			req, err := c.decrypt(ct)
+			if err != nil {
+				t.Errorf("passthrough: decrypt: %v", err)
+				return
+			}
+			var inner struct {
+				Method string            `json:"method"`
+				Params map[string]string `json:"params"`
+			}
+			json.Unmarshal(req, &inner)
+
+			var resp string
+			switch inner.Method {
+			case "login_device":
+				if u, exp := inner.Params["username"], "NjNhNzEwNTY5MjYxYTI0YjM3NjYyNzViNzAwMGNlOGQ3YjMyZTJmNw=="; u != exp {
+					t.Errorf("login: expected username %q, got %q", exp, u)
+				}
+				if p, exp := inner.Params["password"], "cGFzc3dvcmQ="; p != exp {
+					t.Errorf("login: expected password %q, got %q", exp, p)
+				}
+				resp = `{"error_code":0,"result":{"token":"abc"}}`
+			default:
+				if tok := r.URL.Query().Get("token"); tok != "abc" {
+					t.Errorf("request: expected token, got %q", tok)
+				}
+				resp = `{"error_code":0,"result":{"echo":` + string(req) + `}}`
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 0, "result": map[string]string{"response": base64.StdEncoding.EncodeToString(c.encrypt([]byte(resp)))}})
+		default:
+			t.Errorf("unexpected method %q", env.Method)
+		}
+	}))
+	defer hs.Close()
+
+	var out struct {
+		Result struct {
+			Echo struct {
+				Test int `json:"test"`
+			} `json:"echo"`
+		} `json:"result"`
+	}
+	if err := (&Client{
+		Addr:     strings.TrimPrefix(hs.URL, "http://"),
+		Username: "user@example.com",
+		Password: "password",
+	}).Request(map[string]int{"test": 1}, &out); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if out.Result.Echo.Test != 1 {
+		t.Errorf("incorrect response %#v", out)
+	}
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
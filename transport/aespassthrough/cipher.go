@@ -0,0 +1,39 @@
+package aespassthrough
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+
+	"github.com/pgaskin/kasa/internal/pkcs7"
+)
+
+// cipherState encrypts and decrypts messages for a session. The IV is the same
+// for every message.
+type cipherState struct {
+	key []byte
+	iv  []byte
+}
+
+func (c *cipherState) encrypt(msg []byte) []byte {
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		panic(err)
+	}
+	ct := pkcs7.Pad(msg, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, c.iv).CryptBlocks(ct, ct)
+	return ct
+}
+
+func (c *cipherState) decrypt(ct []byte) ([]byte, error) {
+	if len(ct) == 0 || len(ct)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid ciphertext length")
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		panic(err)
+	}
+	pt := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, c.iv).CryptBlocks(pt, ct)
+	return pkcs7.Unpad(pt, aes.BlockSize)
+}
@@ -0,0 +1,244 @@
+package aespassthrough
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+// Server implements the device side of the protocol as a http.Handler. Inner
+// requests other than login_device are passed to the Handler as-is.
+type Server struct {
+	Username       string
+	Password       string
+	Handler        transport.Handler
+	SessionTimeout time.Duration // if zero, DefaultSessionTimeout is used
+
+	mu   sync.Mutex
+	sess map[string]*serverSession
+}
+
+type serverSession struct {
+	expires time.Time
+	cipher  *cipherState
+	token   string
+}
+
+var _ http.Handler = (*Server)(nil)
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path != "/app" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var env struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&env); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	switch env.Method {
+	case "handshake":
+		s.handshake(w, env.Params)
+	case "securePassthrough":
+		s.passthrough(w, r, env.Params)
+	default:
+		s.reply(w, -1, nil)
+	}
+}
+
+func (s *Server) handshake(w http.ResponseWriter, params json.RawMessage) {
+	var p struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		s.reply(w, -1, nil)
+		return
+	}
+
+	b, _ := pem.Decode([]byte(p.Key))
+	if b == nil {
+		s.reply(w, -1, nil)
+		return
+	}
+	k, err := x509.ParsePKIXPublicKey(b.Bytes)
+	if err != nil {
+		s.reply(w, -1, nil)
+		return
+	}
+	pub, ok := k.(*rsa.PublicKey)
+	if !ok {
+		s.reply(w, -1, nil)
+		return
+	}
+
+	kiv, id := make([]byte, 32), make([]byte, 16)
+	if _, err := rand.Read(kiv); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	enc, err := rsa.EncryptPKCS1v15(rand.Reader, pub, kiv)
+	if err != nil {
+		s.reply(w, -1, nil)
+		return
+	}
+
+	timeout := s.SessionTimeout
+	if timeout <= 0 {
+		timeout = DefaultSessionTimeout
+	}
+
+	sid := hex.EncodeToString(id)
+	s.mu.Lock()
+	if s.sess == nil {
+		s.sess = map[string]*serverSession{}
+	}
+	for k, v := range s.sess {
+		if time.Now().After(v.expires) {
+			delete(s.sess, k)
+		}
+	}
+	s.sess[sid] = &serverSession{
+		expires: time.Now().Add(timeout),
+		cipher:  &cipherState{key: kiv[:16], iv: kiv[16:]},
+	}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: sid})
+	http.SetCookie(w, &http.Cookie{Name: "TIMEOUT", Value: strconv.Itoa(int(timeout / time.Second))})
+	s.reply(w, 0, map[string]string{"key": base64.StdEncoding.EncodeToString(enc)})
+}
+
+func (s *Server) passthrough(w http.ResponseWriter, r *http.Request, params json.RawMessage) {
+	var sid string
+	var sess serverSession
+	if ck, err := r.Cookie(SessionCookie); err == nil {
+		sid = ck.Value
+		s.mu.Lock()
+		if x, ok := s.sess[ck.Value]; ok && time.Now().Before(x.expires) {
+			sess = *x
+		}
+		s.mu.Unlock()
+	}
+	if sess.cipher == nil {
+		s.reply(w, ErrCodeSessionExpired, nil)
+		return
+	}
+
+	var p struct {
+		Request string `json:"request"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		s.reply(w, -1, nil)
+		return
+	}
+	enc, err := base64.StdEncoding.DecodeString(p.Request)
+	if err != nil {
+		s.reply(w, -1, nil)
+		return
+	}
+	req, err := sess.cipher.decrypt(enc)
+	if err != nil {
+		s.reply(w, -1, nil)
+		return
+	}
+
+	var inner struct {
+		Method string `json:"method"`
+		Params struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"params"`
+	}
+	json.Unmarshal(req, &inner)
+
+	var resp []byte
+	if inner.Method == "login_device" {
+		h := sha1.Sum([]byte(s.Username))
+		if inner.Params.Username != base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString(h[:]))) || inner.Params.Password != base64.StdEncoding.EncodeToString([]byte(s.Password)) {
+			resp = []byte(`{"error_code":` + strconv.Itoa(ErrCodeLoginFailed) + `}`)
+		} else {
+			tok := make([]byte, 16)
+			if _, err := rand.Read(tok); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			sess.token = hex.EncodeToString(tok)
+
+			s.mu.Lock()
+			if x, ok := s.sess[sid]; ok {
+				x.token = sess.token
+			}
+			s.mu.Unlock()
+
+			resp = []byte(`{"error_code":0,"result":{"token":"` + sess.token + `"}}`)
+		}
+	} else {
+		if sess.token == "" || r.URL.Query().Get("token") != sess.token {
+			// like devices, this is reported in the inner response
+			resp = []byte(`{"error_code":` + strconv.Itoa(ErrCodeSessionExpired) + `}`)
+		} else if resp, err = s.Handler.HandleRequest(req); err != nil {
+			s.reply(w, -1, nil)
+			return
+		}
+	}
+
+	s.reply(w, 0, map[string]string{"response": base64.StdEncoding.EncodeToString(sess.cipher.encrypt(resp))})
+}
+
+func (s *Server) reply(w http.ResponseWriter, code int, res interface{}) {
+	v := map[string]interface{}{"error_code": code}
+	if res != nil {
+		v["result"] = res
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf)
+}
+
+// Expire invalidates all sessions.
+func (s *Server) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sess = nil
+}
+
+// ExpireTokens invalidates the login tokens of all sessions, but keeps the
+// sessions themselves.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, x := range s.sess {
+		x.token = ""
+	}
+}
@@ -0,0 +1,270 @@
+// Package chaos implements a transport.Requester which injects faults for
+// testing how controllers handle misbehaving devices.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/transport"
+)
+
+// Fault is a set of faults to inject into a request.
+type Fault uint
+
+const (
+	Latency  Fault = 1 << iota // delay the request by up to MaxLatency
+	Drop                       // don't send the request, and fail with a timeout after DropTimeout
+	Truncate                   // send the request, but fail as if the response was truncated
+	Corrupt                    // send the request, but corrupt the response
+	APIError                   // don't send the request, and respond with one of Errors
+)
+
+func (f Fault) String() string {
+	var s []string
+	for i, n := range []string{"latency", "drop", "truncate", "corrupt", "api error"} {
+		if f&(1<<i) != 0 {
+			s = append(s, n)
+		}
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, "+")
+}
+
+var (
+	DefaultMaxLatency  = time.Second
+	DefaultDropTimeout = time.Second * 5
+	DefaultErrors      = []tpcommand.Error{
+		{Code: tpcommand.ErrModuleNotSupport, Message: "module not support"},
+		{Code: tpcommand.ErrMethodNotSupport, Message: "member not support"},
+		{Code: tpcommand.ErrInvalidArgument, Message: "invalid argument"},
+	}
+)
+
+// Requester wraps a Requester, injecting faults with the configured
+// probabilities (from 0 to 1), or according to Schedule.
+type Requester struct {
+	Requester transport.Requester
+	Seed      int64 // seed for choosing faults, latencies, and errors
+
+	Latency  float64 // probability of the Latency fault
+	Drop     float64 // probability of the Drop fault
+	Truncate float64 // probability of the Truncate fault
+	Corrupt  float64 // probability of the Corrupt fault
+	APIError float64 // probability of the APIError fault
+
+	// Schedule, if set, is used instead of the probabilities to choose the
+	// faults for request n (zero-indexed).
+	Schedule func(n int) Fault
+
+	MaxLatency  time.Duration     // maximum added latency (if zero, DefaultMaxLatency is used)
+	DropTimeout time.Duration     // time to wait before failing a dropped request (if zero, DefaultDropTimeout is used)
+	Errors      []tpcommand.Error // errors to respond with (if empty, DefaultErrors is used)
+
+	once sync.Once
+	mu   sync.Mutex
+	rand *rand.Rand
+	n    int
+}
+
+var _ transport.ContextRequester = (*Requester)(nil)
+
+// Error is returned for requests failed by the Drop and Truncate faults.
+type Error struct {
+	Fault Fault
+	Err   error
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("chaos: injected %s: %v", err.Fault, err.Err)
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Timeout returns true for dropped requests.
+func (err *Error) Timeout() bool {
+	return err.Fault == Drop
+}
+
+// Temporary returns true, for compatibility with net.Error.
+func (err *Error) Temporary() bool {
+	return true
+}
+
+// MayHaveReachedDevice returns false for dropped requests.
+func (err *Error) MayHaveReachedDevice() bool {
+	return err.Fault != Drop
+}
+
+func (r *Requester) Request(in, out interface{}) error {
+	return r.RequestContext(context.Background(), in, out)
+}
+
+func (r *Requester) RequestContext(ctx context.Context, in, out interface{}) error {
+	var (
+		fault   Fault
+		latency time.Duration
+		apiErr  tpcommand.Error
+		corrupt int64
+	)
+	r.with(func(rnd *rand.Rand, n int) {
+		if r.Schedule != nil {
+			fault = r.Schedule(n)
+		} else {
+			for _, x := range []struct {
+				Fault Fault
+				P     float64
+			}{
+				{Latency, r.Latency},
+				{Drop, r.Drop},
+				{Truncate, r.Truncate},
+				{Corrupt, r.Corrupt},
+				{APIError, r.APIError},
+			} {
+				if x.P > 0 && rnd.Float64() < x.P {
+					fault |= x.Fault
+				}
+			}
+		}
+		if fault&Latency != 0 {
+			max := r.MaxLatency
+			if max <= 0 {
+				max = DefaultMaxLatency
+			}
+			latency = time.Duration(rnd.Int63n(int64(max)))
+		}
+		if fault&APIError != 0 {
+			errs := r.Errors
+			if len(errs) == 0 {
+				errs = DefaultErrors
+			}
+			apiErr = errs[rnd.Intn(len(errs))]
+		}
+		corrupt = rnd.Int63()
+	})
+
+	if fault&Latency != 0 {
+		if err := sleep(ctx, latency); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case fault&Drop != 0:
+		timeout := r.DropTimeout
+		if timeout <= 0 {
+			timeout = DefaultDropTimeout
+		}
+		if err := sleep(ctx, timeout); err != nil {
+			return err
+		}
+		return &Error{Fault: Drop, Err: fmt.Errorf("no response after %s", timeout)}
+
+	case fault&APIError != 0:
+		if out == nil {
+			return nil
+		}
+		resp, err := errorResponse(in, apiErr)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		if err := json.Unmarshal(resp, out); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		return nil
+
+	case fault&(Truncate|Corrupt) != 0:
+		if out == nil {
+			// don't ask for a response the caller didn't
+			if err := transport.RequestContext(ctx, r.Requester, in, nil); err != nil {
+				return err
+			}
+			if fault&Truncate != 0 {
+				return &Error{Fault: Truncate, Err: io.ErrUnexpectedEOF}
+			}
+			return nil
+		}
+		var raw json.RawMessage
+		if err := transport.RequestContext(ctx, r.Requester, in, &raw); err != nil {
+			return err
+		}
+		if fault&Truncate != 0 {
+			return &Error{Fault: Truncate, Err: io.ErrUnexpectedEOF}
+		}
+		if len(raw) != 0 {
+			raw = append(json.RawMessage(nil), raw...)
+			raw[corrupt%int64(len(raw))] ^= byte(corrupt>>32) | 1
+		}
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		return nil
+	}
+
+	return transport.RequestContext(ctx, r.Requester, in, out)
+}
+
+// with calls fn with the random number generator and the request index.
+func (r *Requester) with(fn func(rnd *rand.Rand, n int)) {
+	r.once.Do(func() {
+		r.rand = rand.New(rand.NewSource(r.Seed))
+	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn(r.rand, r.n)
+	r.n++
+}
+
+// errorResponse builds a response to the request in where each method fails
+// with err.
+func errorResponse(in interface{}, err tpcommand.Error) ([]byte, error) {
+	buf, merr := json.Marshal(in)
+	if merr != nil {
+		return nil, merr
+	}
+
+	var req map[string]map[string]json.RawMessage
+	if merr := json.Unmarshal(buf, &req); merr != nil {
+		return nil, merr
+	}
+
+	ck := tpcommand.Checked{ErrCode: tpcommand.IntPtr(int(err.Code))}
+	if err.Message != "" {
+		ck.ErrMsg = tpcommand.StrPtr(err.Message)
+	}
+
+	resp := map[string]map[string]tpcommand.Checked{}
+	for mod, methods := range req {
+		if mod == "context" {
+			continue
+		}
+		resp[mod] = map[string]tpcommand.Checked{}
+		for method := range methods {
+			resp[mod][method] = ck
+		}
+	}
+	return json.Marshal(resp)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
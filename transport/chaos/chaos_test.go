@@ -0,0 +1,164 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/sim"
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+)
+
+var getSysInfo = map[string]interface{}{
+	"system": map[string]interface{}{
+		"get_sysinfo": struct{}{},
+	},
+}
+
+func TestRequester(t *testing.T) {
+	faults := []Fault{0, Latency, Drop, Truncate, Corrupt, APIError}
+	r := &Requester{
+		Requester:   sim.NewBulb(sim.Profiles["KL130"]),
+		MaxLatency:  time.Millisecond * 10,
+		DropTimeout: time.Millisecond * 10,
+		Errors:      []tpcommand.Error{{Code: -99, Message: "test"}},
+		Schedule: func(n int) Fault {
+			return faults[n]
+		},
+	}
+
+	var out smartbulb.SmartBulbCommand
+	for _, f := range faults {
+		out = smartbulb.SmartBulbCommand{}
+		err := r.Request(getSysInfo, &out)
+
+		var cerr *Error
+		switch f {
+		case 0, Latency:
+			if err != nil || out.SysInfo == nil || out.SysInfo.GetSysInfo == nil || out.SysInfo.GetSysInfo.CheckError() != nil {
+				t.Errorf("%s: unexpected result %v %#v", f, err, out)
+			}
+		case Drop:
+			if !errors.As(err, &cerr) || !cerr.Timeout() || cerr.MayHaveReachedDevice() {
+				t.Errorf("%s: expected timeout error, got %v", f, err)
+			}
+		case Truncate:
+			if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.As(err, &cerr) || !cerr.MayHaveReachedDevice() {
+				t.Errorf("%s: expected truncated error, got %v", f, err)
+			}
+		case Corrupt:
+			// checked by TestRequesterCorrupt
+		case APIError:
+			var terr tpcommand.Error
+			if err != nil || out.SysInfo == nil || out.SysInfo.GetSysInfo == nil || !errors.As(out.SysInfo.GetSysInfo.CheckError(), &terr) || terr.Code != -99 {
+				t.Errorf("%s: expected api error, got %v %#v", f, err, out)
+			}
+		}
+	}
+}
+
+func TestRequesterSeed(t *testing.T) {
+	run := func(seed int64) []bool {
+		r := &Requester{
+			Requester: sim.NewBulb(sim.Profiles["KL130"]),
+			Seed:      seed,
+			APIError:  0.5,
+		}
+		var res []bool
+		for i := 0; i < 32; i++ {
+			var out smartbulb.SmartBulbCommand
+			if err := r.Request(getSysInfo, &out); err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			res = append(res, out.SysInfo.GetSysInfo.CheckError() != nil)
+		}
+		return res
+	}
+
+	a, b := run(1), run(1)
+	var n int
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("results differ for the same seed")
+		}
+		if a[i] {
+			n++
+		}
+	}
+	if n == 0 || n == len(a) {
+		t.Errorf("expected some requests to fail, got %d/%d", n, len(a))
+	}
+}
+
+func TestRequesterContext(t *testing.T) {
+	r := &Requester{
+		Requester: sim.NewBulb(sim.Profiles["KL130"]),
+		Drop:      1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if err := r.RequestContext(ctx, getSysInfo, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context error, got %v", err)
+	}
+}
+
+type staticRequester []byte
+
+func (s staticRequester) Request(in, out interface{}) error {
+	return json.Unmarshal(s, out)
+}
+
+func TestRequesterCorrupt(t *testing.T) {
+	resp := []byte(`{"system":{"get_sysinfo":{"alias":"test","err_code":0}}}`)
+	r := &Requester{
+		Requester: staticRequester(resp),
+		Corrupt:   1,
+	}
+	for i := 0; i < 16; i++ {
+		var out json.RawMessage
+		if err := r.Request(getSysInfo, &out); err == nil && bytes.Equal(out, resp) {
+			t.Errorf("expected response to be corrupted")
+		}
+	}
+}
+
+type outRequester struct {
+	Out []bool
+}
+
+func (o *outRequester) Request(in, out interface{}) error {
+	o.Out = append(o.Out, out != nil)
+	if out != nil {
+		return json.Unmarshal([]byte(`{}`), out)
+	}
+	return nil
+}
+
+func TestRequesterNoOutput(t *testing.T) {
+	for _, f := range []Fault{Truncate, Corrupt, Truncate | Corrupt} {
+		o := &outRequester{}
+		r := &Requester{
+			Requester: o,
+			Schedule:  func(int) Fault { return f },
+		}
+		err := r.Request(getSysInfo, nil)
+		if len(o.Out) != 1 || o.Out[0] {
+			t.Errorf("%s: expected request without a response, got %v", f, o.Out)
+		}
+		var cerr *Error
+		if f&Truncate != 0 {
+			if !errors.As(err, &cerr) || cerr.Fault != Truncate {
+				t.Errorf("%s: expected truncate error, got %v", f, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", f, err)
+		}
+	}
+}
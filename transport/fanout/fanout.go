@@ -0,0 +1,135 @@
+// Package fanout sends the same request to many devices concurrently.
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+var DefaultConcurrency = 16
+
+// Fanout sends requests to multiple devices concurrently. For UDP requests to
+// linkie devices where the response isn't needed, linkie.Burst has less
+// stagger.
+type Fanout struct {
+	Concurrency int           // maximum number of concurrent requests (if zero, DefaultConcurrency is used)
+	Timeout     time.Duration // deadline for each device, in addition to the one on the context
+}
+
+// Result is the result of a request to a single device.
+type Result struct {
+	Requester transport.Requester
+	Response  json.RawMessage // the raw response, if it was read
+	Err       error
+}
+
+// Decode unmarshals the response into out.
+func (r Result) Decode(out interface{}) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.Response == nil {
+		return fmt.Errorf("response not read")
+	}
+	return json.Unmarshal(r.Response, out)
+}
+
+// Results contains the results for each device, in the same order as the
+// requesters.
+type Results []Result
+
+// Failed returns the results which have an error.
+func (rs Results) Failed() Results {
+	var f Results
+	for _, r := range rs {
+		if r.Err != nil {
+			f = append(f, r)
+		}
+	}
+	return f
+}
+
+// Err returns an error if any request failed.
+func (rs Results) Err() error {
+	f := rs.Failed()
+	switch len(f) {
+	case 0:
+		return nil
+	case 1:
+		return f[0].Err
+	default:
+		return fmt.Errorf("%d of %d requests failed (first error: %w)", len(f), len(rs), f[0].Err)
+	}
+}
+
+// Request sends in to each requester using the default options. If read is
+// false, the response isn't read (which may allow the request to be made over
+// UDP).
+func Request(ctx context.Context, rs []transport.Requester, in interface{}, read bool) Results {
+	return (&Fanout{}).Request(ctx, rs, in, read)
+}
+
+// Request sends in to each requester. If read is false, the response isn't
+// read (which may allow the request to be made over UDP).
+func (f *Fanout) Request(ctx context.Context, rs []transport.Requester, in interface{}, read bool) Results {
+	res := make(Results, len(rs))
+	for i, r := range rs {
+		res[i].Requester = r
+	}
+
+	req, err := json.Marshal(in)
+	if err != nil {
+		for i := range res {
+			res[i].Err = fmt.Errorf("encode request: %w", err)
+		}
+		return res
+	}
+
+	n := f.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	if n > len(rs) {
+		n = len(rs)
+	}
+
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				res[i].Response, res[i].Err = f.request(ctx, rs[i], req, read)
+			}
+		}()
+	}
+	for i := range rs {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	return res
+}
+
+func (f *Fanout) request(ctx context.Context, r transport.Requester, req json.RawMessage, read bool) (json.RawMessage, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	if !read {
+		return nil, transport.RequestContext(ctx, r, req, nil)
+	}
+	var resp json.RawMessage
+	if err := transport.RequestContext(ctx, r, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,110 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/sim"
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+	"github.com/pgaskin/kasa/transport"
+)
+
+type slowRequester struct {
+	Delay  time.Duration
+	Active *int32
+	Max    *int32
+}
+
+func (s slowRequester) RequestContext(ctx context.Context, in, out interface{}) error {
+	n := atomic.AddInt32(s.Active, 1)
+	defer atomic.AddInt32(s.Active, -1)
+	for {
+		m := atomic.LoadInt32(s.Max)
+		if n <= m || atomic.CompareAndSwapInt32(s.Max, m, n) {
+			break
+		}
+	}
+	select {
+	case <-time.After(s.Delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s slowRequester) Request(in, out interface{}) error {
+	return s.RequestContext(context.Background(), in, out)
+}
+
+func TestFanout(t *testing.T) {
+	var rs []transport.Requester
+	var bulbs []*sim.Bulb
+	for i := 0; i < 40; i++ {
+		b := sim.NewBulb(sim.Profiles["KL130"])
+		bulbs = append(bulbs, b)
+		rs = append(rs, b)
+	}
+
+	res := Request(context.Background(), rs, smartbulb.SmartBulbCommand{
+		LightingService: &smartbulb.LightingServiceModule{
+			TransitionLightState: &smartbulb.TransitionLightStateMethod{
+				LightState: smartbulb.LightState{
+					OnOff: tpcommand.IntPtr(0),
+				},
+			},
+		},
+	}, true)
+	if err := res.Err(); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	for i, r := range res {
+		if r.Requester != rs[i] {
+			t.Errorf("result %d: incorrect order", i)
+		}
+		var out smartbulb.SmartBulbCommand
+		if err := r.Decode(&out); err != nil {
+			t.Errorf("result %d: decode: %v", i, err)
+		} else if m := out.LightingService.TransitionLightState; m == nil || m.CheckError() != nil || m.OnOff == nil || *m.OnOff != 0 {
+			t.Errorf("result %d: unexpected response %s", i, r.Response)
+		}
+	}
+}
+
+func TestFanoutLimits(t *testing.T) {
+	var active, max int32
+	var rs []transport.Requester
+	for i := 0; i < 8; i++ {
+		d := time.Millisecond * 10
+		if i%2 == 1 {
+			d = time.Second * 10
+		}
+		rs = append(rs, slowRequester{Delay: d, Active: &active, Max: &max})
+	}
+
+	f := &Fanout{
+		Concurrency: 3,
+		Timeout:     time.Millisecond * 50,
+	}
+	res := f.Request(context.Background(), rs, struct{}{}, false)
+
+	if n := atomic.LoadInt32(&max); n != 3 {
+		t.Errorf("expected 3 concurrent requests, got %d", n)
+	}
+	if n := len(res.Failed()); n != 4 {
+		t.Errorf("expected 4 failures, got %d", n)
+	}
+	for i, r := range res {
+		if i%2 == 1 && !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Errorf("result %d: expected deadline exceeded, got %v", i, r.Err)
+		} else if i%2 == 0 && r.Err != nil {
+			t.Errorf("result %d: unexpected error %v", i, r.Err)
+		}
+	}
+	if !errors.Is(res.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected combined error to wrap deadline exceeded, got %v", res.Err())
+	}
+}
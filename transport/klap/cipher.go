@@ -0,0 +1,123 @@
+package klap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/pgaskin/kasa/internal/pkcs7"
+)
+
+// AuthHash returns the hash used to authenticate the handshake. If legacy is
+// true, the hash for the first version of the protocol is returned.
+func AuthHash(username, password string, legacy bool) []byte {
+	if legacy {
+		u, p := md5.Sum([]byte(username)), md5.Sum([]byte(password))
+		h := md5.Sum(concat(u[:], p[:]))
+		return h[:]
+	}
+	u, p := sha1.Sum([]byte(username)), sha1.Sum([]byte(password))
+	h := sha256.Sum256(concat(u[:], p[:]))
+	return h[:]
+}
+
+// serverHash returns the hash sent by the device in response to handshake1.
+func serverHash(localSeed, remoteSeed, authHash []byte, legacy bool) []byte {
+	if legacy {
+		return sha256Sum(localSeed, authHash)
+	}
+	return sha256Sum(localSeed, remoteSeed, authHash)
+}
+
+// clientHash returns the hash sent by the client in handshake2.
+func clientHash(localSeed, remoteSeed, authHash []byte, legacy bool) []byte {
+	if legacy {
+		return sha256Sum(remoteSeed, authHash)
+	}
+	return sha256Sum(remoteSeed, localSeed, authHash)
+}
+
+// cipherState encrypts and decrypts messages for a session.
+type cipherState struct {
+	key []byte
+	iv  []byte
+	sig []byte
+	seq int32
+}
+
+func newCipherState(localSeed, remoteSeed, authHash []byte) *cipherState {
+	h := concat(localSeed, remoteSeed, authHash)
+	iv := sha256Sum([]byte("iv"), h)
+	return &cipherState{
+		key: sha256Sum([]byte("lsk"), h)[:16],
+		iv:  iv[:12],
+		sig: sha256Sum([]byte("ldk"), h)[:28],
+		seq: int32(binary.BigEndian.Uint32(iv[28:])),
+	}
+}
+
+// next increments and returns the sequence number.
+func (c *cipherState) next() int32 {
+	c.seq++
+	return c.seq
+}
+
+// encrypt encrypts and signs msg using the specified sequence number.
+func (c *cipherState) encrypt(msg []byte, seq int32) []byte {
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		panic(err)
+	}
+	ct := pkcs7.Pad(msg, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, c.ivSeq(seq)).CryptBlocks(ct, ct)
+	return append(c.signature(ct, seq), ct...)
+}
+
+// decrypt verifies and decrypts payload using the specified sequence number.
+func (c *cipherState) decrypt(payload []byte, seq int32) ([]byte, error) {
+	if len(payload) < sha256.Size+aes.BlockSize || (len(payload)-sha256.Size)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid payload length %d", len(payload))
+	}
+	sig, ct := payload[:sha256.Size], payload[sha256.Size:]
+	if subtle.ConstantTimeCompare(sig, c.signature(ct, seq)) != 1 {
+		return nil, errors.New("invalid signature")
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		panic(err)
+	}
+	pt := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, c.ivSeq(seq)).CryptBlocks(pt, ct)
+	return pkcs7.Unpad(pt, aes.BlockSize)
+}
+
+func (c *cipherState) ivSeq(seq int32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(seq))
+	return concat(c.iv, b[:])
+}
+
+func (c *cipherState) signature(ct []byte, seq int32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(seq))
+	return sha256Sum(c.sig, b[:], ct)
+}
+
+func sha256Sum(b ...[]byte) []byte {
+	h := sha256.Sum256(concat(b...))
+	return h[:]
+}
+
+func concat(b ...[]byte) []byte {
+	var r []byte
+	for _, x := range b {
+		r = append(r, x...)
+	}
+	return r
+}
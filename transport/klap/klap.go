@@ -0,0 +1,209 @@
+// Package klap implements the KLAP protocol used by newer firmware for TP-Link
+// smart home devices, which encrypts requests with AES over HTTP on port 80
+// after a challenge-response handshake.
+package klap
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/internal/expiry"
+	"github.com/pgaskin/kasa/transport"
+)
+
+const (
+	DevicePort    = 80
+	SessionCookie = "TP_SESSIONID"
+)
+
+var (
+	DefaultTimeout        = time.Second * 10
+	DefaultSessionTimeout = time.Hour * 24
+)
+
+// ErrAuth is returned when the device rejects the credentials.
+var ErrAuth = errors.New("authentication failed")
+
+type Client struct {
+	Addr       string // host, with an optional port
+	Username   string
+	Password   string
+	LegacyAuth bool         // use the hashes for the first version of the protocol
+	HTTPClient *http.Client // if nil, a client with DefaultTimeout is used
+
+	mu   sync.Mutex
+	sess *clientSession
+}
+
+type clientSession struct {
+	cookie  string
+	expires time.Time
+	cipher  *cipherState
+}
+
+var _ transport.ContextRequester = (*Client)(nil)
+
+func (c *Client) Request(in, out interface{}) error {
+	return c.RequestContext(context.Background(), in, out)
+}
+
+func (c *Client) RequestContext(ctx context.Context, in, out interface{}) error {
+	req, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	// requests need to be serialized since the sequence number must match
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var resp []byte
+	for retry := true; ; retry = false {
+		if c.sess == nil || time.Now().After(c.sess.expires) {
+			if c.sess, err = c.handshake(ctx); err != nil {
+				c.sess = nil
+				return err
+			}
+		}
+
+		var expired bool
+		if resp, expired, err = c.request(ctx, c.sess, req); err == nil {
+			break
+		}
+		if expired {
+			c.sess = nil
+			if retry {
+				continue
+			}
+		}
+		return err
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(resp, out); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// handshake starts a new session.
+func (c *Client) handshake(ctx context.Context) (*clientSession, error) {
+	authHash := AuthHash(c.Username, c.Password, c.LegacyAuth)
+
+	localSeed := make([]byte, 16)
+	if _, err := rand.Read(localSeed); err != nil {
+		return nil, fmt.Errorf("handshake1: generate seed: %w", err)
+	}
+
+	resp, body, err := c.post(ctx, "/app/handshake1", localSeed, "")
+	if err != nil {
+		return nil, fmt.Errorf("handshake1: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("handshake1: response status %s", resp.Status)
+	}
+	if len(body) != 48 {
+		return nil, fmt.Errorf("handshake1: invalid response length %d", len(body))
+	}
+	remoteSeed, hash := body[:16], body[16:]
+
+	if subtle.ConstantTimeCompare(hash, serverHash(localSeed, remoteSeed, authHash, c.LegacyAuth)) != 1 {
+		return nil, fmt.Errorf("handshake1: %w", ErrAuth)
+	}
+
+	sess := &clientSession{
+		expires: time.Now().Add(DefaultSessionTimeout),
+		cipher:  newCipherState(localSeed, remoteSeed, authHash),
+	}
+	for _, ck := range resp.Cookies() {
+		switch ck.Name {
+		case SessionCookie:
+			sess.cookie = ck.Value
+		case "TIMEOUT":
+			if n, err := strconv.Atoi(ck.Value); err == nil && n > 0 {
+				sess.expires = expiry.Time(time.Duration(n) * time.Second)
+			}
+		}
+	}
+	if sess.cookie == "" {
+		return nil, fmt.Errorf("handshake1: missing session cookie")
+	}
+
+	if resp, _, err := c.post(ctx, "/app/handshake2", clientHash(localSeed, remoteSeed, authHash, c.LegacyAuth), sess.cookie); err != nil {
+		return nil, fmt.Errorf("handshake2: %w", err)
+	} else if resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("handshake2: %w", ErrAuth)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("handshake2: response status %s", resp.Status)
+	}
+
+	return sess, nil
+}
+
+// request sends an encrypted request. If the device rejected the session,
+// expired will be true.
+func (c *Client) request(ctx context.Context, sess *clientSession, req []byte) (resp []byte, expired bool, err error) {
+	seq := sess.cipher.next()
+
+	r, body, err := c.post(ctx, "/app/request?seq="+strconv.FormatInt(int64(seq), 10), sess.cipher.encrypt(req, seq), sess.cookie)
+	if err != nil {
+		return nil, false, fmt.Errorf("send request: %w", err)
+	}
+	if r.StatusCode == http.StatusForbidden {
+		return nil, true, fmt.Errorf("send request: session expired")
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("send request: response status %s", r.Status)
+	}
+
+	if resp, err = sess.cipher.decrypt(body, seq); err != nil {
+		return nil, false, fmt.Errorf("decrypt response: %w", err)
+	}
+	return resp, false, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body []byte, cookie string) (*http.Response, []byte, error) {
+	host := c.Addr
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, strconv.Itoa(DevicePort))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+host+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookie, Value: cookie})
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1<<24))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+	return resp, buf, nil
+}
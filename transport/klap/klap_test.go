@@ -0,0 +1,213 @@
+package klap
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/sim"
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+)
+
+func TestClient(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		s := &Server{
+			Username:   "user@example.com",
+			Password:   "password",
+			LegacyAuth: legacy,
+			Handler:    sim.NewBulb(sim.Profiles["KL125"]),
+		}
+		var (
+			mu         sync.Mutex
+			handshakes int
+			seqs       []int64
+		)
+		hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			switch r.URL.Path {
+			case "/app/handshake1":
+				handshakes++
+			case "/app/request":
+				seq, _ := strconv.ParseInt(r.URL.Query().Get("seq"), 10, 32)
+				seqs = append(seqs, seq)
+			}
+			mu.Unlock()
+			s.ServeHTTP(w, r)
+		}))
+
+		c := &Client{
+			Addr:       strings.TrimPrefix(hs.URL, "http://"),
+			Username:   "user@example.com",
+			Password:   "password",
+			LegacyAuth: legacy,
+		}
+		for i := 0; i < 3; i++ {
+			if i == 2 {
+				s.Expire()
+			}
+			var resp smartbulb.SmartBulbCommand
+			if err := c.Request(smartbulb.SmartBulbCommand{
+				LightingService: &smartbulb.LightingServiceModule{
+					TransitionLightState: &smartbulb.TransitionLightStateMethod{
+						LightState: smartbulb.LightState{Brightness: tpcommand.IntPtr(10 + i)},
+					},
+				},
+			}, &resp); err != nil {
+				t.Fatalf("legacy=%t: request %d: %v", legacy, i, err)
+			}
+			if m := resp.LightingService.TransitionLightState; m.CheckError() != nil || *m.Brightness != 10+i {
+				t.Errorf("legacy=%t: request %d: incorrect response", legacy, i)
+			}
+		}
+
+		// the third request is rejected since the session expired, then it is
+		// retried after a new handshake
+		mu.Lock()
+		if handshakes != 2 {
+			t.Errorf("legacy=%t: expected 2 handshakes, got %d", legacy, handshakes)
+		}
+		if len(seqs) != 4 {
+			t.Errorf("legacy=%t: expected 4 requests, got %d", legacy, len(seqs))
+		} else if seqs[1] != seqs[0]+1 || seqs[2] != seqs[1]+1 {
+			t.Errorf("legacy=%t: expected sequence number to be incremented for each request in a session, got %v", legacy, seqs)
+		}
+		mu.Unlock()
+
+		c = &Client{
+			Addr:       c.Addr,
+			Username:   "user@example.com",
+			Password:   "wrong",
+			LegacyAuth: legacy,
+		}
+		if err := c.Request(struct{}{}, nil); !errors.Is(err, ErrAuth) {
+			t.Errorf("legacy=%t: expected auth error, got %v", legacy, err)
+		}
+
+		hs.Close()
+	}
+}
+
+// The vectors below were computed separately with Python's hashlib and
+// OpenSSL, following python-kasa's KlapEncryptionSession.
+var (
+	testLocalSeed  = mustHex("000102030405060708090a0b0c0d0e0f")
+	testRemoteSeed = mustHex("101112131415161718191a1b1c1d1e1f")
+)
+
+func TestHandshake(t *testing.T) {
+	for _, tc := range []struct {
+		Legacy     bool
+		AuthHash   string
+		ServerHash string
+		ClientHash string
+	}{
+		{
+			Legacy:     false,
+			AuthHash:   "7c5a94e6c3a98773a333e7c5d2a4755842eec1fcb9ef6ea5d55d185aee69186c",
+			ServerHash: "f522196e08b17f7eeb7de0615b197f7636b96ebf4f4620305af661cb30538515",
+			ClientHash: "b13273c1fef9029ed43b2cf254dc1f7b22c35b301b62ef97ad157e1357bd536c",
+		},
+		{
+			Legacy:     true,
+			AuthHash:   "60c1ac5df029534df37f3e036d148af4",
+			ServerHash: "9d93d4df90a219777c9763923a94063257f6c377dc1660eebe4e2871e1570d38",
+			ClientHash: "173fc6eb2e094a5839140ddcf764e2c5c06d56cad2697f25fa2f695e83f2f5aa",
+		},
+	} {
+		ah := AuthHash("user@example.com", "password", tc.Legacy)
+		if x := hex.EncodeToString(ah); x != tc.AuthHash {
+			t.Errorf("legacy=%t: auth hash: expected %s, got %s", tc.Legacy, tc.AuthHash, x)
+		}
+		if x := hex.EncodeToString(serverHash(testLocalSeed, testRemoteSeed, ah, tc.Legacy)); x != tc.ServerHash {
+			t.Errorf("legacy=%t: server hash: expected %s, got %s", tc.Legacy, tc.ServerHash, x)
+		}
+		if x := hex.EncodeToString(clientHash(testLocalSeed, testRemoteSeed, ah, tc.Legacy)); x != tc.ClientHash {
+			t.Errorf("legacy=%t: client hash: expected %s, got %s", tc.Legacy, tc.ClientHash, x)
+		}
+	}
+}
+
+func TestCipher(t *testing.T) {
+	c := newCipherState(testLocalSeed, testRemoteSeed, AuthHash("user@example.com", "password", false))
+	if x, exp := hex.EncodeToString(c.key), "e3a2a0717a7becd0baf3d873a896787b"; x != exp {
+		t.Errorf("key: expected %s, got %s", exp, x)
+	}
+	if x, exp := hex.EncodeToString(c.iv), "1e71259c60aecd791ff11475"; x != exp {
+		t.Errorf("iv: expected %s, got %s", exp, x)
+	}
+	if x, exp := hex.EncodeToString(c.sig), "c78f80a56ff19f39d7e9af6951b3db3e5f2c70d4819c9e4c0688f042"; x != exp {
+		t.Errorf("sig: expected %s, got %s", exp, x)
+	}
+	if exp := int32(2130631173); c.seq != exp {
+		t.Errorf("seq: expected %d, got %d", exp, c.seq)
+	}
+
+	msg := `{"system":{"get_sysinfo":{}}}`
+	seq := c.next()
+	if exp := int32(2130631174); seq != exp {
+		t.Errorf("next seq: expected %d, got %d", exp, seq)
+	}
+	payload := c.encrypt([]byte(msg), seq)
+	if x, exp := hex.EncodeToString(payload), "500fa5652e818875a7edd6a23bf651aeeeeb4ef4677140a2734efaf5ef5b8c20de5faa216ac8a7d42d96480fdefe22459da04f47488e70beecdb21b6837573c7"; x != exp {
+		t.Errorf("encrypt: expected %s, got %s", exp, x)
+	}
+	if pt, err := c.decrypt(payload, seq); err != nil {
+		t.Errorf("decrypt: %v", err)
+	} else if string(pt) != msg {
+		t.Errorf("decrypt: got %q", pt)
+	}
+	if _, err := c.decrypt(payload, seq+1); err == nil {
+		t.Errorf("decrypt: expected error for incorrect sequence number")
+	}
+	payload[len(payload)-1] ^= 1
+	if _, err := c.decrypt(payload, seq); err == nil {
+		t.Errorf("decrypt: expected error for modified ciphertext")
+	}
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestClientShortTimeout(t *testing.T) {
+	s := &Server{
+		Username:       "user@example.com",
+		Password:       "password",
+		SessionTimeout: time.Second * 30,
+		Handler:        sim.NewBulb(sim.Profiles["KL125"]),
+	}
+	var handshakes int32
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app/handshake1" {
+			atomic.AddInt32(&handshakes, 1)
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer hs.Close()
+
+	c := &Client{
+		Addr:     strings.TrimPrefix(hs.URL, "http://"),
+		Username: "user@example.com",
+		Password: "password",
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.Request(struct{}{}, nil); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&handshakes); n != 1 {
+		t.Errorf("expected session to be reused, got %d handshakes", n)
+	}
+}
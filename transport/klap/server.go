@@ -0,0 +1,189 @@
+package klap
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+// Server implements the device side of the protocol as a http.Handler.
+type Server struct {
+	Username       string
+	Password       string
+	LegacyAuth     bool
+	Handler        transport.Handler
+	SessionTimeout time.Duration // if zero, DefaultSessionTimeout is used
+
+	mu   sync.Mutex
+	sess map[string]*serverSession
+}
+
+type serverSession struct {
+	localSeed  []byte
+	remoteSeed []byte
+	expires    time.Time
+	verified   bool
+	cipher     *cipherState
+}
+
+var _ http.Handler = (*Server)(nil)
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/app/handshake1":
+		s.handshake1(w, body)
+	case "/app/handshake2":
+		s.handshake2(w, r, body)
+	case "/app/request":
+		s.request(w, r, body)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handshake1(w http.ResponseWriter, localSeed []byte) {
+	if len(localSeed) != 16 {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	remoteSeed, id := make([]byte, 16), make([]byte, 16)
+	if _, err := rand.Read(remoteSeed); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	timeout := s.SessionTimeout
+	if timeout <= 0 {
+		timeout = DefaultSessionTimeout
+	}
+
+	sid := hex.EncodeToString(id)
+	s.mu.Lock()
+	if s.sess == nil {
+		s.sess = map[string]*serverSession{}
+	}
+	for k, v := range s.sess {
+		if time.Now().After(v.expires) {
+			delete(s.sess, k)
+		}
+	}
+	s.sess[sid] = &serverSession{
+		localSeed:  localSeed,
+		remoteSeed: remoteSeed,
+		expires:    time.Now().Add(timeout),
+	}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: sid})
+	http.SetCookie(w, &http.Cookie{Name: "TIMEOUT", Value: strconv.Itoa(int(timeout / time.Second))})
+	w.Write(append(remoteSeed, serverHash(localSeed, remoteSeed, AuthHash(s.Username, s.Password, s.LegacyAuth), s.LegacyAuth)...))
+}
+
+func (s *Server) handshake2(w http.ResponseWriter, r *http.Request, hash []byte) {
+	sess := s.session(r)
+	if sess == nil {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	authHash := AuthHash(s.Username, s.Password, s.LegacyAuth)
+	if subtle.ConstantTimeCompare(hash, clientHash(sess.localSeed, sess.remoteSeed, authHash, s.LegacyAuth)) != 1 {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	sess.verified = true
+	sess.cipher = newCipherState(sess.localSeed, sess.remoteSeed, authHash)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) request(w http.ResponseWriter, r *http.Request, payload []byte) {
+	var c *cipherState
+	if sess := s.session(r); sess != nil {
+		s.mu.Lock()
+		if sess.verified {
+			c = sess.cipher
+		}
+		s.mu.Unlock()
+	}
+	if c == nil {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	seq, err := strconv.ParseInt(r.URL.Query().Get("seq"), 10, 32)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	req, err := c.decrypt(payload, int32(seq))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.Handler.HandleRequest(req)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(c.encrypt(resp, int32(seq)))
+}
+
+// session gets the unexpired session for r, if any.
+func (s *Server) session(r *http.Request) *serverSession {
+	ck, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sess[ck.Value]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sess, ck.Value)
+		return nil
+	}
+	return sess
+}
+
+// Expire invalidates all sessions.
+func (s *Server) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sess = nil
+}
@@ -0,0 +1,73 @@
+package linkie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Burst sends the same request over UDP to each address (a host or host:port,
+// like Client.Addr) back-to-back from a single socket, without waiting for
+// replies. This minimizes the stagger when controlling many devices at once.
+// All addresses are attempted even if some fail, and the first error is
+// returned.
+func Burst(ctx context.Context, addrs []string, in interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return &Error{Op: OpEncode, Err: err}
+	}
+	msg := Encrypt(b)
+
+	var (
+		first error
+		uas   []*net.UDPAddr
+	)
+	for _, a := range addrs {
+		ua, err := resolveUDP(ctx, (&Client{Addr: a}).addr())
+		if err != nil {
+			if first == nil {
+				first = &Error{Op: OpDial, Net: "udp", Addr: a, Err: err}
+			}
+			continue
+		}
+		uas = append(uas, ua)
+	}
+
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return &Error{Op: OpDial, Net: "udp", Err: err}
+	}
+	defer pc.Close()
+	defer watchContext(ctx, pc.(net.Conn))()
+
+	pc.SetWriteDeadline(deadline(ctx, 0, DefaultRequestTimeout))
+
+	for _, ua := range uas {
+		if _, err := pc.WriteTo(msg, ua); err != nil && first == nil {
+			first = &Error{Op: OpWrite, Net: "udp", Addr: ua.String(), Err: contextErr(ctx, err)}
+		}
+	}
+	return first
+}
+
+// resolveUDP resolves a host:port.
+func resolveUDP(ctx context.Context, addr string) (*net.UDPAddr, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: p}, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: ips[0].IP, Port: p, Zone: ips[0].Zone}, nil
+}
@@ -0,0 +1,42 @@
+package linkie
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBurst(t *testing.T) {
+	var addrs []string
+	var conns []*net.UDPConn
+	for i := 0; i < 3; i++ {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+		addrs = append(addrs, conn.LocalAddr().String())
+	}
+
+	if err := Burst(context.Background(), addrs, map[string]int{"test": 1}); err != nil {
+		t.Fatalf("burst: %v", err)
+	}
+	for i, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Errorf("device %d: read: %v", i, err)
+		} else if req := string(Decrypt(buf[:n])); req != `{"test":1}` {
+			t.Errorf("device %d: unexpected request %q", i, req)
+		}
+	}
+
+	var lerr *Error
+	if err := Burst(context.Background(), []string{"127.0.0.1:bad"}, struct{}{}); !errors.As(err, &lerr) || lerr.Op != OpDial {
+		t.Errorf("expected dial error, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package linkie
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// SizePrefixLen is the length of the big-endian size prefix used for TCP.
+const SizePrefixLen = 4
+
+// Encrypt encrypts a message without the size prefix (i.e., for UDP).
+func Encrypt(b []byte) []byte {
+	r := make([]byte, len(b))
+	encrypt(CryptoIV, r, b)
+	return r
+}
+
+// Decrypt decrypts a message without the size prefix (i.e., for UDP).
+func Decrypt(b []byte) []byte {
+	r := make([]byte, len(b))
+	decrypt(CryptoIV, r, b)
+	return r
+}
+
+// encrypt encrypts src into dst, returning the new key.
+func encrypt(key byte, dst, src []byte) byte {
+	for i, c := range src {
+		key = c ^ key
+		dst[i] = key
+	}
+	return key
+}
+
+// decrypt decrypts src into dst, returning the new key. It is safe for dst
+// and src to be the same slice.
+func decrypt(key byte, dst, src []byte) byte {
+	for i, c := range src {
+		key, dst[i] = c, c^key
+	}
+	return key
+}
+
+// frame encrypts a message with the size prefix (i.e., for TCP).
+func frame(b []byte) []byte {
+	r := make([]byte, SizePrefixLen+len(b))
+	r[0] = byte(uint32(len(b)) >> 24)
+	r[1] = byte(uint32(len(b)) >> 16)
+	r[2] = byte(uint32(len(b)) >> 8)
+	r[3] = byte(uint32(len(b)) >> 0)
+	encrypt(CryptoIV, r[SizePrefixLen:], b)
+	return r
+}
+
+// Writer encrypts a stream without size prefixes.
+type Writer struct {
+	w   io.Writer
+	key byte
+}
+
+// NewWriter returns a Writer which encrypts data written to it into w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, key: CryptoIV}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	key := encrypt(w.key, buf, p)
+	n, err := w.w.Write(buf)
+	if n == len(buf) {
+		w.key = key
+	} else if n > 0 {
+		w.key = buf[n-1]
+	}
+	return n, err
+}
+
+// Reader decrypts a stream without size prefixes.
+type Reader struct {
+	r   io.Reader
+	key byte
+}
+
+// NewReader returns a Reader which decrypts data read from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, key: CryptoIV}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.key = decrypt(r.key, p[:n], p[:n])
+	return n, err
+}
+
+// FrameWriter writes size-prefixed messages.
+type FrameWriter struct {
+	w io.Writer
+}
+
+// NewFrameWriter returns a FrameWriter which writes to w.
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+// Write encrypts and writes p as a single message.
+func (w *FrameWriter) Write(p []byte) (int, error) {
+	if uint64(len(p)) > math.MaxUint32 {
+		return 0, &FrameTooLargeError{Size: int64(len(p)), Max: math.MaxUint32}
+	}
+	n, err := w.w.Write(frame(p))
+	if n -= SizePrefixLen; n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// FrameReader reads a single size-prefixed message, returning io.EOF once the
+// end of it is reached. If the size exceeds the maximum, a
+// *FrameTooLargeError is returned. If the message is truncated,
+// io.ErrUnexpectedEOF is returned.
+type FrameReader struct {
+	r   io.Reader
+	key byte
+	max int64
+	sz  int
+	n   int // including the size prefix
+}
+
+// NewFrameReader returns a FrameReader which reads from r. If max is
+// non-zero, it is the maximum message size.
+func NewFrameReader(r io.Reader, max int64) *FrameReader {
+	return &FrameReader{r: r, key: CryptoIV, max: max}
+}
+
+func (d *FrameReader) Read(p []byte) (n int, err error) {
+	if d.n == 0 {
+		var x [SizePrefixLen]byte
+		if _, err := io.ReadFull(d.r, x[:]); err != nil {
+			if err == io.EOF {
+				return 0, fmt.Errorf("read size: %w", io.ErrUnexpectedEOF)
+			}
+			return 0, fmt.Errorf("read size: %w", err)
+		}
+		sz := int64(uint32(x[3]) | uint32(x[2])<<8 | uint32(x[1])<<16 | uint32(x[0])<<24)
+		if d.max > 0 && sz > d.max {
+			return 0, &FrameTooLargeError{Size: sz, Max: d.max}
+		}
+		d.sz = int(sz)
+		d.n = SizePrefixLen
+	} else if d.n-SizePrefixLen >= d.sz {
+		return 0, io.EOF
+	}
+
+	if r := d.sz - (d.n - SizePrefixLen); len(p) > r {
+		p = p[:r]
+	}
+
+	n, err = d.r.Read(p)
+	d.n += n
+	d.key = decrypt(d.key, p[:n], p[:n])
+
+	if err == io.EOF && (d.n-SizePrefixLen) != d.sz {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+package linkie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCodec(t *testing.T) {
+	if x := hex.EncodeToString(frame(DiscoveryRequest)); x[:32] != "0000001dd0f281f88bff9af7d5ef94b6" {
+		t.Errorf("incorrect encrypted discovery request %s", x)
+	}
+	for _, v := range []string{"", "{}", `{"system":{"get_sysinfo":{}}}`} {
+		if x := Decrypt(Encrypt([]byte(v))); string(x) != v {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q", v, x)
+		}
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		for i := range v {
+			w.Write([]byte{v[i]})
+		}
+		if x := Encrypt([]byte(v)); !bytes.Equal(x, buf.Bytes()) {
+			t.Errorf("Writer(%q) = %x, expected %x", v, buf.Bytes(), x)
+		}
+
+		if x, err := io.ReadAll(NewReader(iotest.OneByteReader(&buf))); err != nil || string(x) != v {
+			t.Errorf("Reader(%q) = %q, %v", v, x, err)
+		}
+
+		buf.Reset()
+		for i := 0; i < 2; i++ {
+			if n, err := NewFrameWriter(&buf).Write([]byte(v)); err != nil || n != len(v) {
+				t.Errorf("FrameWriter(%q) = %d, %v", v, n, err)
+			}
+		}
+		for i := 0; i < 2; i++ {
+			if x, err := io.ReadAll(NewFrameReader(iotest.HalfReader(&buf), 0)); err != nil || string(x) != v {
+				t.Errorf("FrameReader(%q) = %q, %v", v, x, err)
+			}
+		}
+		if buf.Len() != 0 {
+			t.Errorf("FrameReader(%q) didn't read all frames", v)
+		}
+	}
+}
+
+func TestFrameReaderErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		Input []byte
+		Max   int64
+		Error error
+	}{
+		{"Empty", nil, 0, io.ErrUnexpectedEOF},
+		{"TruncatedSize", []byte{0x00, 0x00}, 0, io.ErrUnexpectedEOF},
+		{"TruncatedBody", []byte{0x00, 0x00, 0x00, 0x02, 0x00}, 0, io.ErrUnexpectedEOF},
+		{"TooLarge", []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00}, 1, &FrameTooLargeError{}},
+	} {
+		_, err := io.ReadAll(NewFrameReader(bytes.NewReader(tc.Input), tc.Max))
+		if ferr := (*FrameTooLargeError)(nil); errors.As(tc.Error, &ferr) {
+			if !errors.As(err, &ferr) {
+				t.Errorf("%s: expected frame too large error, got %v", tc.Name, err)
+			}
+		} else if !errors.Is(err, tc.Error) {
+			t.Errorf("%s: expected error %v, got %v", tc.Name, tc.Error, err)
+		}
+	}
+}
+
+func FuzzCodec(f *testing.F) {
+	f.Add([]byte(`{"system":{"get_sysinfo":{}}}`))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if x := Decrypt(Encrypt(b)); !bytes.Equal(x, b) {
+			t.Errorf("Decrypt(Encrypt(%x)) = %x", b, x)
+		}
+
+		var buf bytes.Buffer
+		NewFrameWriter(&buf).Write(b)
+		if x, err := io.ReadAll(NewFrameReader(iotest.OneByteReader(&buf), int64(len(b)))); err != nil || !bytes.Equal(x, b) {
+			t.Errorf("FrameReader(FrameWriter(%x)) = %x, %v", b, x, err)
+		}
+	})
+}
+
+func FuzzFrameReader(f *testing.F) {
+	f.Add(frame(DiscoveryRequest))
+	f.Add([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	f.Add([]byte{0x00, 0x00, 0x00, 0x10, 0x00})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		x, err := io.ReadAll(NewFrameReader(bytes.NewReader(b), 1<<16))
+		if err != nil {
+			return
+		}
+		if y := frame(x); !bytes.Equal(y, b[:len(y)]) {
+			t.Errorf("frame(FrameReader(%x)) = %x", b, y)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package linkie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+)
+
+// DefaultDiscoveryTimeout is the default amount of time to wait for replies to
+// a discovery request.
+var DefaultDiscoveryTimeout = time.Second * 3
+
+// DiscoveryRequest is the request broadcast to discover devices.
+var DiscoveryRequest = []byte(`{"system":{"get_sysinfo":{}}}`)
+
+// Discoverer finds devices by broadcasting a get_sysinfo request over UDP.
+type Discoverer struct {
+	Broadcast []net.IP      // addresses to send the request to (if empty, BroadcastAddrs is used)
+	Port      int           // port to send the request to (if zero, DevicePort is used)
+	Timeout   time.Duration // time to wait for replies
+}
+
+// Discovery is a reply to a discovery request.
+type Discovery struct {
+	Addr     *net.UDPAddr
+	Response json.RawMessage // decrypted response
+}
+
+// BroadcastError is returned by Discover if the request couldn't be sent to
+// any of the broadcast addresses.
+type BroadcastError struct {
+	Addrs []net.IP
+	Errs  []error // for each address
+}
+
+func (err *BroadcastError) Error() string {
+	var b strings.Builder
+	b.WriteString("write request")
+	for i, ip := range err.Addrs {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(ip.String())
+		b.WriteString(": ")
+		b.WriteString(err.Errs[i].Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the first error.
+func (err *BroadcastError) Unwrap() error {
+	if len(err.Errs) == 0 {
+		return nil
+	}
+	return err.Errs[0]
+}
+
+// Discover discovers devices using the default options.
+func Discover() ([]Discovery, error) {
+	return new(Discoverer).Discover()
+}
+
+// Discover broadcasts the discovery request and collects the replies until the
+// timeout elapses. Only the first reply from each address is returned.
+func (d *Discoverer) Discover() ([]Discovery, error) {
+	return d.DiscoverContext(context.Background())
+}
+
+// DiscoverContext is like Discover, but stops collecting replies early if the
+// context deadline is reached first. If the context is cancelled, the replies
+// received so far are returned along with the context error. If the request
+// can't be sent to some of the broadcast addresses, the rest are still used,
+// and a *BroadcastError is only returned if it couldn't be sent to any.
+func (d *Discoverer) DiscoverContext(ctx context.Context) ([]Discovery, error) {
+	bcast := d.Broadcast
+	if len(bcast) == 0 {
+		if x, err := BroadcastAddrs(); err != nil {
+			return nil, fmt.Errorf("get broadcast addresses: %w", err)
+		} else if len(x) == 0 {
+			bcast = []net.IP{net.IPv4bcast}
+		} else {
+			bcast = x
+		}
+	}
+
+	port := d.Port
+	if port == 0 {
+		port = DevicePort
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listen (udp): %w", err)
+	}
+	defer conn.Close()
+
+	defer watchContext(ctx, conn)()
+
+	conn.SetDeadline(deadline(ctx, d.Timeout, DefaultDiscoveryTimeout))
+
+	var werr BroadcastError
+	req := Encrypt(DiscoveryRequest)
+	for _, ip := range bcast {
+		if _, err := conn.WriteToUDP(req, &net.UDPAddr{IP: ip, Port: port}); err != nil {
+			werr.Addrs = append(werr.Addrs, ip)
+			werr.Errs = append(werr.Errs, err)
+		}
+	}
+	if len(werr.Errs) == len(bcast) {
+		return nil, &werr
+	}
+
+	var ds []Discovery
+	seen := map[string]bool{}
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return ds, ctx.Err()
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			return ds, fmt.Errorf("read response: %w", err)
+		}
+		if seen[addr.String()] {
+			continue
+		}
+		resp := Decrypt(buf[:n])
+		if !json.Valid(resp) {
+			continue // not a device
+		}
+		seen[addr.String()] = true
+		ds = append(ds, Discovery{
+			Addr:     addr,
+			Response: resp,
+		})
+	}
+	return ds, nil
+}
+
+// SysInfo returns the raw get_sysinfo response.
+func (d Discovery) SysInfo() (json.RawMessage, error) {
+	var resp struct {
+		System *struct {
+			GetSysInfo json.RawMessage `json:"get_sysinfo"`
+		} `json:"system"`
+	}
+	if err := json.Unmarshal(d.Response, &resp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if resp.System == nil || resp.System.GetSysInfo == nil {
+		return nil, fmt.Errorf("parse response: missing system.get_sysinfo")
+	}
+	return resp.System.GetSysInfo, nil
+}
+
+// SmartBulb decodes the get_sysinfo response as a smart bulb. Protocol-level
+// errors are checked.
+func (d Discovery) SmartBulb() (*smartbulb.GetSysInfoMethod, error) {
+	buf, err := d.SysInfo()
+	if err != nil {
+		return nil, err
+	}
+	var m smartbulb.GetSysInfoMethod
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if err := m.CheckError(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// BroadcastAddrs returns the IPv4 broadcast addresses of the non-loopback
+// interfaces which are up.
+func BroadcastAddrs() ([]net.IP, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, i := range ifs {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagBroadcast == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := i.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("get addresses for %s: %w", i.Name, err)
+		}
+		for _, a := range addrs {
+			n, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, mask := n.IP.To4(), n.Mask
+			if ip == nil || len(mask) != net.IPv4len {
+				continue
+			}
+			b := make(net.IP, net.IPv4len)
+			for j := range b {
+				b[j] = ip[j] | ^mask[j]
+			}
+			ips = append(ips, b)
+		}
+	}
+	return ips, nil
+}
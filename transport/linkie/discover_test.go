@@ -0,0 +1,69 @@
+package linkie
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiscover(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if req := Decrypt(buf[:n]); !bytes.Equal(req, DiscoveryRequest) {
+				t.Errorf("unexpected request %q", req)
+				continue
+			}
+			// reply twice to ensure duplicates are ignored
+			for i := 0; i < 2; i++ {
+				conn.WriteToUDP(Encrypt([]byte(`{"system":{"get_sysinfo":{"model":"KL130(US)","alias":"test","err_code":0}}}`)), addr)
+			}
+		}
+	}()
+
+	ds, err := (&Discoverer{
+		Broadcast: []net.IP{net.IPv6loopback, net.IPv4(127, 0, 0, 1)}, // the first one can't be written to the udp4 socket
+		Port:      conn.LocalAddr().(*net.UDPAddr).Port,
+		Timeout:   time.Millisecond * 500,
+	}).Discover()
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(ds) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(ds))
+	}
+	if !ds[0].Addr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("expected device address to be 127.0.0.1, got %s", ds[0].Addr.IP)
+	}
+	if m, err := ds[0].SmartBulb(); err != nil {
+		t.Errorf("decode sysinfo: %v", err)
+	} else if m.Model == nil || *m.Model != "KL130(US)" || m.Alias == nil || *m.Alias != "test" {
+		t.Errorf("incorrect sysinfo %#v", m)
+	}
+}
+
+func TestDiscoverWriteError(t *testing.T) {
+	_, err := (&Discoverer{
+		Broadcast: []net.IP{net.IPv6loopback, net.IPv6linklocalallnodes},
+		Timeout:   time.Millisecond * 100,
+	}).Discover()
+	var berr *BroadcastError
+	if !errors.As(err, &berr) {
+		t.Fatalf("expected broadcast error, got %v", err)
+	}
+	if len(berr.Addrs) != 2 || len(berr.Errs) != 2 {
+		t.Errorf("expected an error for each address, got %v", berr)
+	}
+}
@@ -0,0 +1,75 @@
+package linkie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// ErrNoReply is returned when AckUDP is set and the device doesn't reply to
+// any of the attempts.
+var ErrNoReply = errors.New("no reply to udp request")
+
+// FrameTooLargeError is returned when the size prefix of a message exceeds the
+// maximum size.
+type FrameTooLargeError struct {
+	Size int64
+	Max  int64
+}
+
+func (err *FrameTooLargeError) Error() string {
+	return fmt.Sprintf("frame size %d exceeds maximum %d", err.Size, err.Max)
+}
+
+// Op is the stage of a request.
+type Op string
+
+const (
+	OpEncode Op = "encode request"
+	OpDial   Op = "connect"
+	OpWrite  Op = "write request"
+	OpRead   Op = "read response"
+	OpDecode Op = "parse response"
+)
+
+// Error is returned by Client and Session when a request fails. If the context
+// was cancelled, Err will be the context error.
+type Error struct {
+	Op   Op     // the stage which failed
+	Net  string // tcp or udp, if known
+	Addr string // the device address
+	Err  error  // the underlying error
+}
+
+func (err *Error) Error() string {
+	if err.Op == OpDial {
+		return fmt.Sprintf("%s (%s): %v", err.Op, err.Net, err.Err)
+	}
+	return fmt.Sprintf("%s: %v", err.Op, err.Err)
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Timeout returns true if the error was caused by a timeout or context
+// deadline.
+func (err *Error) Timeout() bool {
+	var nerr net.Error
+	return errors.Is(err.Err, os.ErrDeadlineExceeded) || errors.Is(err.Err, context.DeadlineExceeded) || errors.Is(err.Err, ErrNoReply) || (errors.As(err.Err, &nerr) && nerr.Timeout())
+}
+
+// Framing returns true if the response was truncated or had an invalid size.
+func (err *Error) Framing() bool {
+	var ferr *FrameTooLargeError
+	return err.Op == OpRead && (errors.As(err.Err, &ferr) || errors.Is(err.Err, io.ErrUnexpectedEOF))
+}
+
+// MayHaveReachedDevice returns false if the request definitely wasn't sent to
+// the device.
+func (err *Error) MayHaveReachedDevice() bool {
+	return err.Op != OpEncode && err.Op != OpDial
+}
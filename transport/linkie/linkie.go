@@ -1,15 +1,14 @@
 // Package linkie implements the protocol for TP-Link smart home devices with
 // xor-encoded communication over port 9999.
-//
-// TODO: discovery
 package linkie
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pgaskin/kasa/transport"
@@ -24,162 +23,264 @@ var (
 	DefaultConnectionTimeout = time.Second * 5
 	DefaultRequestTimeout    = time.Second * 5
 	DefaultResponseTimeout   = time.Second * 15
+	DefaultMaxResponseSize   = int64(1 << 20)
+	DefaultUDPRetransmit     = time.Millisecond * 500
+	DefaultUDPAttempts       = 3
 )
 
+// Dialer opens connections to devices. It is implemented by *net.Dialer.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
 type Client struct {
 	IP                net.IP
+	Addr              string        // if set, the host or host:port to connect to instead of IP
+	Port              int           // port to use if not specified by Addr (if zero, DevicePort is used)
+	Dialer            Dialer        // if set, used instead of a net.Dialer to connect to the device
 	ConnectionTimeout time.Duration // timeout for connecting
 	RequestTimeout    time.Duration // timeout for writing the request
 	ResponseTimeout   time.Duration // timeout for reading the response
+	MaxResponseSize   int64         // maximum response size (if zero, DefaultMaxResponseSize is used)
+	AckUDP            bool          // whether to wait for the reply to UDP requests, retransmitting them if needed
+	UDPRetransmit     time.Duration // time to wait for a UDP reply before retransmitting (if zero, DefaultUDPRetransmit is used)
+	UDPAttempts       int           // maximum number of times to send a UDP request (if zero, DefaultUDPAttempts is used)
+	Observer          Observer      // if set, notified after each request
 }
 
-var _ transport.Requester = (*Client)(nil)
+var _ transport.ContextRequester = (*Client)(nil)
 
 func (c *Client) Request(in, out interface{}) error {
-	var req encReader
-	if b, err := json.Marshal(in); err != nil {
-		return fmt.Errorf("encode request: %w", err)
-	} else {
-		req.Bytes = b
-		req.Key = CryptoIV
-		req.IncludeSize = out != nil || len(b) > 1024 // i.e. whether to use UDP
+	return c.RequestContext(context.Background(), in, out)
+}
+
+func (c *Client) RequestContext(ctx context.Context, in, out interface{}) (err error) {
+	tr := &Trace{
+		Addr:  c.addr(),
+		Start: time.Now(),
 	}
+	defer func() {
+		c.observe(tr, err)
+	}()
 
-	var d net.Dialer
-	if c.ConnectionTimeout > 0 {
-		d.Timeout = c.ConnectionTimeout
-	} else {
-		d.Timeout = DefaultConnectionTimeout
+	req, err := json.Marshal(in)
+	if err != nil {
+		return &Error{Op: OpEncode, Addr: tr.Addr, Err: err}
 	}
+	tr.Request = req
 
-	var conn net.Conn
-	if req.IncludeSize {
-		if x, err := net.DialTCP("tcp", nil, &net.TCPAddr{IP: c.IP, Port: 9999}); err != nil {
-			return fmt.Errorf("connect (tcp): %w", err)
-		} else {
-			conn = x
-		}
+	var network string
+	if out != nil || len(req) > 1024 {
+		network = "tcp"
 	} else {
-		if x, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: c.IP, Port: 9999}); err != nil {
-			return fmt.Errorf("connect (udp): %w", err)
-		} else {
-			conn = x
-		}
+		network = "udp"
+	}
+	tr.Protocol = network
+
+	conn, err := c.dial(ctx, network)
+	tr.Dial = time.Since(tr.Start)
+	if err != nil {
+		return &Error{Op: OpDial, Net: network, Addr: tr.Addr, Err: err}
 	}
 	defer conn.Close()
 
-	if c.RequestTimeout > 0 {
-		conn.SetWriteDeadline(time.Now().Add(c.RequestTimeout))
+	if network == "udp" && c.AckUDP {
+		return c.roundTripUDP(ctx, conn, req, tr)
+	}
+
+	var msg []byte
+	if network == "tcp" {
+		msg = frame(req)
 	} else {
-		conn.SetWriteDeadline(time.Now().Add(DefaultRequestTimeout))
+		msg = Encrypt(req)
 	}
 
-	if _, err := io.Copy(conn, &req); err != nil {
-		return fmt.Errorf("write request: %w", err)
+	resp, _, err := c.roundTrip(ctx, conn, msg, out != nil, tr)
+	if err != nil {
+		return err
 	}
 
 	if out != nil {
+		if err := json.Unmarshal(resp, out); err != nil {
+			return &Error{Op: OpDecode, Net: tr.Protocol, Addr: tr.Addr, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// roundTrip writes the encrypted req to conn, then reads the response if read
+// is true. If an error occurs while reading the response, partial will be true
+// if any of the response was read. The timings and response are recorded in tr.
+func (c *Client) roundTrip(ctx context.Context, conn net.Conn, req []byte, read bool, tr *Trace) (resp []byte, partial bool, err error) {
+	defer watchContext(ctx, conn)()
+
+	conn.SetWriteDeadline(deadline(ctx, c.RequestTimeout, DefaultRequestTimeout))
+
+	t := time.Now()
+	_, err = conn.Write(req)
+	tr.Write, tr.Attempts = time.Since(t), 1
+	if err != nil {
+		return nil, false, &Error{Op: OpWrite, Net: tr.Protocol, Addr: tr.Addr, Err: contextErr(ctx, err)}
+	}
+
+	if read {
 		var buf bytes.Buffer
 
-		if c.ResponseTimeout > 0 {
-			conn.SetReadDeadline(time.Now().Add(c.ResponseTimeout))
-		} else {
-			conn.SetReadDeadline(time.Now().Add(DefaultResponseTimeout))
-		}
+		conn.SetReadDeadline(deadline(ctx, c.ResponseTimeout, DefaultResponseTimeout))
 
-		if _, err := buf.ReadFrom(&decReader{
-			Source: conn,
-			Key:    CryptoIV,
-		}); err != nil {
-			return fmt.Errorf("read response: %w", err)
+		max := c.MaxResponseSize
+		if max <= 0 {
+			max = DefaultMaxResponseSize
 		}
+		dec := NewFrameReader(conn, max)
 
-		if err := json.Unmarshal(buf.Bytes(), out); err != nil {
-			return fmt.Errorf("parse response: %w", err)
+		t := time.Now()
+		_, err := buf.ReadFrom(dec)
+		tr.Read, tr.Response = time.Since(t), buf.Bytes()
+		if err != nil {
+			return nil, dec.n != 0, &Error{Op: OpRead, Net: tr.Protocol, Addr: tr.Addr, Err: contextErr(ctx, err)}
 		}
+		resp = buf.Bytes()
 	}
 
-	return nil
+	return resp, false, nil
 }
 
-const encSzN = 4
+// roundTripUDP sends req to conn until a reply is received, the maximum number
+// of attempts is reached, or the response timeout elapses. The timings and
+// reply are recorded in tr.
+func (c *Client) roundTripUDP(ctx context.Context, conn net.Conn, req []byte, tr *Trace) error {
+	defer watchContext(ctx, conn)()
 
-type encReader struct {
-	Bytes       []byte
-	Key         byte
-	IncludeSize bool
-	off         int
-}
+	attempts := c.UDPAttempts
+	if attempts <= 0 {
+		attempts = DefaultUDPAttempts
+	}
+
+	end := deadline(ctx, c.ResponseTimeout, DefaultResponseTimeout)
+	buf := make([]byte, 64*1024)
+	enc := Encrypt(req)
+
+	for i := 0; i < attempts; i++ {
+		conn.SetWriteDeadline(deadline(ctx, c.RequestTimeout, DefaultRequestTimeout))
+
+		t := time.Now()
+		_, err := conn.Write(enc)
+		tr.Write += time.Since(t)
+		if err != nil {
+			return &Error{Op: OpWrite, Net: tr.Protocol, Addr: tr.Addr, Err: contextErr(ctx, err)}
+		}
+		tr.Attempts++
+
+		next := time.Now().Add(timeoutOr(c.UDPRetransmit, DefaultUDPRetransmit))
+		if next.After(end) {
+			next = end
+		}
+		conn.SetReadDeadline(next)
 
-func (r *encReader) Read(b []byte) (n int, err error) {
-	t := len(r.Bytes)
-	for n < len(b) {
-		if r.IncludeSize {
-			switch r.off {
-			// big-endian length
-			case 0:
-				b[n] = byte(uint32(t) >> 24)
-			case 1:
-				b[n] = byte(uint32(t) >> 16)
-			case 2:
-				b[n] = byte(uint32(t) >> 8)
-			case 3:
-				b[n] = byte(uint32(t) >> 0)
-			default:
-				if r.off-4 >= t {
-					return n, io.EOF
+		t = time.Now()
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				tr.Read += time.Since(t)
+				if ctx.Err() != nil {
+					return &Error{Op: OpRead, Net: tr.Protocol, Addr: tr.Addr, Err: ctx.Err()}
 				}
-				b[n] = r.Bytes[r.off-4] ^ r.Key
-				r.Key = b[n]
+				if isTimeout(err) {
+					break
+				}
+				return &Error{Op: OpRead, Net: tr.Protocol, Addr: tr.Addr, Err: err}
 			}
-		} else {
-			if r.off >= t {
-				return n, io.EOF
+			if resp := Decrypt(buf[:n]); json.Valid(resp) {
+				tr.Read += time.Since(t)
+				tr.Response = resp
+				return nil
 			}
-			b[n] = r.Bytes[r.off] ^ r.Key
-			r.Key = b[n]
 		}
-		r.off++
-		n++
+
+		if !next.Before(end) {
+			break
+		}
 	}
-	return n, nil
+	return &Error{Op: OpRead, Net: tr.Protocol, Addr: tr.Addr, Err: ErrNoReply}
 }
 
-type decReader struct {
-	Source io.Reader
-	Key    byte
-	sz     int
-	n      int
+// dial connects to the device, limiting the time spent to ConnectionTimeout.
+func (c *Client) dial(ctx context.Context, network string) (net.Conn, error) {
+	timeout := c.ConnectionTimeout
+	if timeout <= 0 {
+		timeout = DefaultConnectionTimeout
+	}
+
+	if c.Dialer == nil {
+		d := net.Dialer{Timeout: timeout}
+		return d.DialContext(ctx, network, c.addr())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return c.Dialer.DialContext(ctx, network, c.addr())
 }
 
-func (d *decReader) Read(p []byte) (n int, err error) {
-	if d.n == 0 {
-		var x [encSzN]byte
-		if _, err := io.ReadFull(d.Source, x[:]); err != nil {
-			if err == io.EOF {
-				return 0, fmt.Errorf("read size: unexpected eof")
-			}
-			return 0, fmt.Errorf("read size: %w", err)
+// addr returns the address of the device.
+func (c *Client) addr() string {
+	if c.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Addr); err == nil {
+			return c.Addr
 		}
-		d.sz = int(uint32(x[3]) | uint32(x[2])<<8 | uint32(x[1])<<16 | uint32(x[0])<<24)
-		d.n = encSzN
-	} else if d.n-encSzN >= d.sz {
-		return 0, io.EOF
 	}
-
-	if r := d.sz - (d.n - encSzN); len(p) > r {
-		p = p[:r]
+	port := c.Port
+	if port == 0 {
+		port = DevicePort
+	}
+	if c.Addr != "" {
+		return net.JoinHostPort(strings.Trim(c.Addr, "[]"), strconv.Itoa(port))
 	}
+	return net.JoinHostPort(c.IP.String(), strconv.Itoa(port))
+}
 
-	n, err = d.Source.Read(p)
-	d.n += n
+// deadline returns the deadline for an operation with the specified timeout,
+// using def if it is zero, limited by the deadline of ctx.
+func deadline(ctx context.Context, timeout, def time.Duration) time.Time {
+	if timeout <= 0 {
+		timeout = def
+	}
+	t := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(t) {
+		t = d
+	}
+	return t
+}
 
-	for i := 0; i < n; i++ {
-		d.Key, p[i] = p[i], p[i]^d.Key
+// watchContext interrupts pending I/O on conn when ctx is cancelled. The
+// returned function must be called to stop watching the context, after which
+// the deadlines of conn will not be modified.
+func watchContext(ctx context.Context, conn net.Conn) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
 	}
+	stopc, donec := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(donec)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-stopc:
+		}
+	}()
+	return func() {
+		close(stopc)
+		<-donec
+	}
+}
 
-	if err == io.EOF && (d.n-encSzN) != d.sz {
-		err = fmt.Errorf("unexpected eof")
+// contextErr replaces err with the context error if the context is done,
+// since the error will have been caused by watchContext.
+func contextErr(ctx context.Context, err error) error {
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
 	}
-	return n, err
+	return err
 }
@@ -0,0 +1,325 @@
+package linkie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	l := listenTCP(t, func(conn net.Conn) {
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(NewFrameReader(conn, 0)); err != nil {
+			t.Errorf("read request: %v", err)
+			return
+		}
+		if buf.String() != `{"test":1}` {
+			t.Errorf("unexpected request %q", buf.String())
+		}
+		NewFrameWriter(conn).Write([]byte(`{"test":2}`))
+	})
+	defer l.Close()
+
+	var out struct {
+		Test int `json:"test"`
+	}
+	if err := testClient(l).Request(map[string]int{"test": 1}, &out); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if out.Test != 2 {
+		t.Errorf("unexpected response %#v", out)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	l := listenTCP(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn) // never respond
+	})
+	defer l.Close()
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		start := time.Now()
+		err := testClient(l).RequestContext(ctx, struct{}{}, new(interface{}))
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected deadline exceeded error, got %v", err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("request took too long (%s)", d)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(time.Millisecond*100, cancel)
+
+		start := time.Now()
+		err := testClient(l).RequestContext(ctx, struct{}{}, new(interface{}))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected cancelled error, got %v", err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("request took too long (%s)", d)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		c := testClient(l)
+		c.ResponseTimeout = time.Millisecond * 100
+
+		err := c.RequestContext(context.Background(), struct{}{}, new(interface{}))
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected deadline exceeded error, got %v", err)
+		}
+	})
+}
+
+// listenTCP starts a TCP server on loopback which calls fn for each
+// connection.
+func listenTCP(t *testing.T, fn func(net.Conn)) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fn(conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func testClient(l net.Listener) *Client {
+	return &Client{Addr: l.Addr().String()}
+}
+
+func TestClientMaxResponseSize(t *testing.T) {
+	l := listenTCP(t, func(conn net.Conn) {
+		var buf bytes.Buffer
+		buf.ReadFrom(NewFrameReader(conn, 0))
+		conn.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+		conn.Write(Encrypt(bytes.Repeat([]byte{' '}, 1<<16)))
+	})
+	defer l.Close()
+
+	c := testClient(l)
+	c.MaxResponseSize = 1 << 10
+
+	var ferr *FrameTooLargeError
+	if err := c.Request(struct{}{}, new(interface{})); !errors.As(err, &ferr) {
+		t.Fatalf("expected frame too large error, got %v", err)
+	}
+	if ferr.Size != 0xFFFFFFFF || ferr.Max != 1<<10 {
+		t.Errorf("incorrect error %#v", ferr)
+	}
+}
+
+func TestClientAckUDP(t *testing.T) {
+	for _, drop := range []int{0, 2, 3} {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+
+		var n int32
+		go func() {
+			buf := make([]byte, 1024)
+			for {
+				sz, addr, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				if atomic.AddInt32(&n, 1) > int32(drop) {
+					conn.WriteToUDP(Encrypt(Decrypt(buf[:sz])), addr)
+				}
+			}
+		}()
+
+		a := conn.LocalAddr().(*net.UDPAddr)
+		c := &Client{
+			IP:            a.IP,
+			AckUDP:        true,
+			UDPRetransmit: time.Millisecond * 50,
+			UDPAttempts:   3,
+			Port:          a.Port,
+		}
+		err = c.Request(struct{}{}, nil)
+		if drop < c.UDPAttempts {
+			if err != nil {
+				t.Errorf("drop %d: unexpected error: %v", drop, err)
+			}
+		} else if !errors.Is(err, ErrNoReply) {
+			t.Errorf("drop %d: expected no reply error, got %v", drop, err)
+		}
+		if x := atomic.LoadInt32(&n); int(x) != drop+1 && !(drop >= c.UDPAttempts && int(x) == c.UDPAttempts) {
+			t.Errorf("drop %d: unexpected number of attempts %d", drop, x)
+		}
+
+		conn.Close()
+	}
+}
+
+func TestClientObserver(t *testing.T) {
+	l := listenTCP(t, func(conn net.Conn) {
+		var buf bytes.Buffer
+		buf.ReadFrom(NewFrameReader(conn, 0))
+		NewFrameWriter(conn).Write([]byte(`{"test":2}`))
+	})
+	defer l.Close()
+
+	var traces []Trace
+	c := testClient(l)
+	c.Observer = ObserverFunc(func(tr *Trace) {
+		traces = append(traces, *tr)
+	})
+
+	if err := c.Request(map[string]int{"test": 1}, new(interface{})); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if err := c.Request(func() {}, nil); err == nil {
+		t.Fatalf("expected encode error")
+	}
+
+	if len(traces) != 2 {
+		t.Fatalf("expected 2 traces, got %d", len(traces))
+	}
+	if tr := traces[0]; tr.Protocol != "tcp" || tr.Addr != l.Addr().String() || string(tr.Request) != `{"test":1}` || string(tr.Response) != `{"test":2}` || tr.Attempts != 1 || tr.Err != nil {
+		t.Errorf("incorrect trace %#v", tr)
+	}
+	if tr := traces[1]; tr.Err == nil || tr.Request != nil {
+		t.Errorf("incorrect trace %#v", tr)
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	for _, tc := range []struct {
+		Client Client
+		Addr   string
+	}{
+		{Client{IP: net.IPv4(192, 168, 0, 1)}, "192.168.0.1:9999"},
+		{Client{IP: net.IPv4(192, 168, 0, 1), Port: 1234}, "192.168.0.1:1234"},
+		{Client{IP: net.ParseIP("fe80::1")}, "[fe80::1]:9999"},
+		{Client{IP: net.IPv4(192, 168, 0, 1), Addr: "localhost:1234"}, "localhost:1234"},
+		{Client{Addr: "localhost", Port: 1234}, "localhost:1234"},
+		{Client{Addr: "localhost"}, "localhost:9999"},
+		{Client{Addr: "[fe80::1]"}, "[fe80::1]:9999"},
+		{Client{Addr: "[fe80::1]:1234"}, "[fe80::1]:1234"},
+	} {
+		if addr := tc.Client.addr(); addr != tc.Addr {
+			t.Errorf("%#v: expected %q, got %q", tc.Client, tc.Addr, addr)
+		}
+	}
+}
+
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (fn dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return fn(ctx, network, address)
+}
+
+func TestClientDialer(t *testing.T) {
+	c := &Client{
+		Addr:              "device.example:1234",
+		ConnectionTimeout: time.Millisecond * 100,
+		Dialer: dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			if network != "tcp" || address != "device.example:1234" {
+				t.Errorf("unexpected dial %s %s", network, address)
+			}
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("expected connection timeout to be applied")
+			}
+			conn, dev := net.Pipe()
+			go func() {
+				defer dev.Close()
+				var buf bytes.Buffer
+				buf.ReadFrom(NewFrameReader(dev, 0))
+				NewFrameWriter(dev).Write(buf.Bytes())
+			}()
+			return conn, nil
+		}),
+	}
+
+	var out int
+	if err := c.Request(1, &out); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if out != 1 {
+		t.Errorf("unexpected response %d", out)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	closed := listenTCP(t, func(net.Conn) {})
+	closed.Close()
+
+	truncated := listenTCP(t, func(conn net.Conn) {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(NewFrameReader(conn, 0))
+		conn.Write([]byte{0x00, 0x00, 0x00, 0x10, 0x00})
+	})
+	defer truncated.Close()
+
+	invalid := listenTCP(t, func(conn net.Conn) {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(NewFrameReader(conn, 0))
+		NewFrameWriter(conn).Write([]byte(`"test"`))
+	})
+	defer invalid.Close()
+
+	silent := listenTCP(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+	defer silent.Close()
+
+	for _, tc := range []struct {
+		Name     string
+		Listener net.Listener
+		In       interface{}
+		Op       Op
+		Reached  bool
+		Framing  bool
+		Timeout  bool
+	}{
+		{"Encode", silent, func() {}, OpEncode, false, false, false},
+		{"Dial", closed, struct{}{}, OpDial, false, false, false},
+		{"Truncated", truncated, struct{}{}, OpRead, true, true, false},
+		{"Decode", invalid, struct{}{}, OpDecode, true, false, false},
+		{"Timeout", silent, struct{}{}, OpRead, true, false, true},
+	} {
+		c := testClient(tc.Listener)
+		c.ResponseTimeout = time.Millisecond * 100
+
+		var lerr *Error
+		if err := c.Request(tc.In, new(int)); !errors.As(err, &lerr) {
+			t.Errorf("%s: expected *Error, got %v", tc.Name, err)
+			continue
+		}
+		if lerr.Op != tc.Op {
+			t.Errorf("%s: expected op %q, got %q", tc.Name, tc.Op, lerr.Op)
+		}
+		if lerr.MayHaveReachedDevice() != tc.Reached {
+			t.Errorf("%s: expected MayHaveReachedDevice to be %t", tc.Name, tc.Reached)
+		}
+		if lerr.Framing() != tc.Framing {
+			t.Errorf("%s: expected Framing to be %t", tc.Name, tc.Framing)
+		}
+		if lerr.Timeout() != tc.Timeout {
+			t.Errorf("%s: expected Timeout to be %t", tc.Name, tc.Timeout)
+		}
+	}
+}
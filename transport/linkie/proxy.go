@@ -0,0 +1,356 @@
+package linkie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ProxyMessage is a message passing through a Proxy.
+type ProxyMessage struct {
+	Protocol string   // tcp or udp
+	Client   net.Addr // the client connected to the proxy
+	Request  bool     // whether the message is from the client to the device
+	JSON     []byte   // plaintext JSON
+	Original []byte   // if Rewrite changed JSON, the original JSON
+}
+
+// Proxy forwards TCP connections and UDP datagrams to a device, decrypting
+// each message so it can be logged or rewritten. Each client TCP connection
+// and UDP source address gets its own connection to the device.
+type Proxy struct {
+	Target         Client        // device to forward to (only the address, ConnectionTimeout, and Dialer are used)
+	IdleTimeout    time.Duration // timeout for idle client connections and UDP flows (if zero, DefaultServerIdleTimeout is used)
+	WriteTimeout   time.Duration // timeout for forwarding a message (if zero, DefaultServerWriteTimeout is used)
+	MaxMessageSize int64         // maximum message size (if zero, DefaultMaxResponseSize is used)
+
+	// Rewrite, if set, is called for each message before it is forwarded, and
+	// may modify m.JSON. If it returns an error, the message is dropped, and
+	// for TCP, the connection is closed. It may be called concurrently.
+	Rewrite func(m *ProxyMessage) error
+
+	// Log, if set, is called for each message after Rewrite. It may be called
+	// concurrently.
+	Log func(m *ProxyMessage)
+
+	mu     sync.Mutex
+	tcp    net.Listener
+	udp    net.PacketConn
+	conns  map[net.Conn]struct{}
+	flows  map[string]net.Conn // udp client address to device conn
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// Listen listens for TCP connections and UDP datagrams on the same address,
+// then forwards them in the background until the proxy is closed. If the port
+// is zero, an arbitrary one will be chosen.
+func (p *Proxy) Listen(addr string) error {
+	tcp, udp, err := listen(addr)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		tcp.Close()
+		udp.Close()
+		return errors.New("proxy closed")
+	}
+	if p.tcp != nil {
+		tcp.Close()
+		udp.Close()
+		return errors.New("proxy already listening")
+	}
+	p.tcp, p.udp = tcp, udp
+	p.conns = map[net.Conn]struct{}{}
+	p.flows = map[string]net.Conn{}
+
+	p.wg.Add(2)
+	go p.serveTCP(tcp)
+	go p.serveUDP(udp)
+
+	return nil
+}
+
+// Addr returns the address the proxy is listening on, or nil if it isn't
+// listening.
+func (p *Proxy) Addr() *net.TCPAddr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tcp == nil {
+		return nil
+	}
+	return p.tcp.Addr().(*net.TCPAddr)
+}
+
+// Close stops the proxy, closes open connections, and waits for pending
+// messages to finish.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+
+	var err error
+	if p.tcp != nil {
+		err = p.tcp.Close()
+		if uerr := p.udp.Close(); err == nil {
+			err = uerr
+		}
+		for c := range p.conns {
+			c.Close()
+		}
+		for _, c := range p.flows {
+			c.Close()
+		}
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+// track adds conns to the set of connections closed by Close. It returns false
+// if the proxy is closed.
+func (p *Proxy) track(conns ...net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	for _, c := range conns {
+		p.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (p *Proxy) untrack(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range conns {
+		delete(p.conns, c)
+	}
+}
+
+func (p *Proxy) serveTCP(l net.Listener) {
+	defer p.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				continue
+			}
+			return
+		}
+		if !p.track(conn) {
+			conn.Close()
+			return
+		}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer p.untrack(conn)
+			defer conn.Close()
+
+			dev, err := p.Target.dial(context.Background(), "tcp")
+			if err != nil {
+				return
+			}
+			if !p.track(dev) {
+				dev.Close()
+				return
+			}
+			defer p.untrack(dev)
+			defer dev.Close()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				p.relay(conn, dev, conn.RemoteAddr(), false)
+				conn.Close()
+			}()
+			p.relay(dev, conn, conn.RemoteAddr(), true)
+			dev.Close()
+			<-done
+		}()
+	}
+}
+
+// relay forwards messages read from src to dst until an error occurs. Only
+// reads from the client are subject to the idle timeout.
+func (p *Proxy) relay(dst, src net.Conn, client net.Addr, request bool) {
+	max := p.maxMessageSize()
+	for {
+		var buf bytes.Buffer
+
+		if request {
+			src.SetReadDeadline(time.Now().Add(timeoutOr(p.IdleTimeout, DefaultServerIdleTimeout)))
+		}
+		if _, err := buf.ReadFrom(NewFrameReader(src, max)); err != nil {
+			return
+		}
+
+		m, ok := p.message("tcp", client, request, buf.Bytes())
+		if !ok {
+			return
+		}
+
+		dst.SetWriteDeadline(time.Now().Add(timeoutOr(p.WriteTimeout, DefaultServerWriteTimeout)))
+
+		if _, err := NewFrameWriter(dst).Write(m); err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) serveUDP(pc net.PacketConn) {
+	defer p.wg.Done()
+	max := p.maxMessageSize()
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				continue
+			}
+			return
+		}
+
+		if int64(n) > max {
+			continue
+		}
+
+		m, ok := p.message("udp", addr, true, Decrypt(buf[:n]))
+		if !ok {
+			continue
+		}
+
+		p.forward(pc, addr, m)
+	}
+}
+
+// forward sends a request from addr to the device. If the flow was closed
+// after an idle timeout while we were still using it, it reconnects.
+func (p *Proxy) forward(pc net.PacketConn, addr net.Addr, m []byte) {
+	for i := 0; i < 2; i++ {
+		dev, err := p.flow(pc, addr)
+		if err != nil {
+			return
+		}
+
+		dev.SetWriteDeadline(time.Now().Add(timeoutOr(p.WriteTimeout, DefaultServerWriteTimeout)))
+		dev.SetReadDeadline(time.Now().Add(timeoutOr(p.IdleTimeout, DefaultServerIdleTimeout)))
+		if _, err := dev.Write(Encrypt(m)); !errors.Is(err, net.ErrClosed) {
+			return
+		}
+		p.removeFlow(addr.String(), dev)
+	}
+}
+
+// flow gets the device connection for UDP datagrams from addr, connecting and
+// starting to forward replies if required.
+func (p *Proxy) flow(pc net.PacketConn, addr net.Addr) (net.Conn, error) {
+	k := addr.String()
+
+	p.mu.Lock()
+	dev, ok := p.flows[k]
+	p.mu.Unlock()
+	if ok {
+		return dev, nil
+	}
+
+	dev, err := p.Target.dial(context.Background(), "udp")
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		dev.Close()
+		return nil, net.ErrClosed
+	}
+	p.flows[k] = dev
+	p.wg.Add(1)
+	p.mu.Unlock()
+
+	go func() {
+		defer p.wg.Done()
+		defer func() {
+			p.removeFlow(k, dev)
+			dev.Close()
+		}()
+
+		max := p.maxMessageSize()
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := dev.Read(buf)
+			if err != nil {
+				return // including when the idle timeout expires
+			}
+			if int64(n) > max {
+				continue
+			}
+			if m, ok := p.message("udp", addr, false, Decrypt(buf[:n])); ok {
+				pc.WriteTo(Encrypt(m), addr)
+			}
+		}
+	}()
+	return dev, nil
+}
+
+// removeFlow removes the device connection for k if it is still dev.
+func (p *Proxy) removeFlow(k string, dev net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.flows[k] == dev {
+		delete(p.flows, k)
+	}
+}
+
+// maxMessageSize returns the effective maximum message size.
+func (p *Proxy) maxMessageSize() int64 {
+	if p.MaxMessageSize <= 0 {
+		return DefaultMaxResponseSize
+	}
+	return p.MaxMessageSize
+}
+
+// message calls the hooks for a message, returning the JSON to forward, or
+// false if it should be dropped.
+func (p *Proxy) message(protocol string, client net.Addr, request bool, b []byte) ([]byte, bool) {
+	m := &ProxyMessage{
+		Protocol: protocol,
+		Client:   client,
+		Request:  request,
+		JSON:     b,
+	}
+	if p.Rewrite != nil {
+		orig := append([]byte(nil), b...)
+		if err := p.Rewrite(m); err != nil {
+			return nil, false
+		}
+		if !bytes.Equal(orig, m.JSON) {
+			m.Original = orig
+		}
+	}
+	if p.Log != nil {
+		p.Log(m)
+	}
+	return m.JSON, true
+}
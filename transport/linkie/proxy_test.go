@@ -0,0 +1,197 @@
+package linkie
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+func TestProxy(t *testing.T) {
+	dev := &Server{
+		Handler: transport.HandlerFunc(func(req []byte) ([]byte, error) {
+			return json.Marshal(map[string]json.RawMessage{"echo": req})
+		}),
+	}
+	if err := dev.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer dev.Close()
+
+	var (
+		mu   sync.Mutex
+		msgs []ProxyMessage
+	)
+	p := &Proxy{
+		Target: Client{Addr: dev.Addr().String()},
+		Rewrite: func(m *ProxyMessage) error {
+			if m.Request {
+				if bytes.Equal(m.JSON, []byte(`"drop"`)) {
+					return errors.New("dropped")
+				}
+				m.JSON = bytes.ReplaceAll(m.JSON, []byte("before"), []byte("after"))
+			}
+			return nil
+		},
+		Log: func(m *ProxyMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			msgs = append(msgs, *m)
+		},
+	}
+	if err := p.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer p.Close()
+
+	for _, c := range []*Client{
+		{Addr: p.Addr().String()},
+		{Addr: p.Addr().String(), AckUDP: true, UDPRetransmit: time.Millisecond * 200},
+	} {
+		mu.Lock()
+		msgs = nil
+		mu.Unlock()
+
+		var protocol string
+		c.Observer = ObserverFunc(func(tr *Trace) {
+			protocol = tr.Protocol
+		})
+
+		var out struct {
+			Echo string `json:"echo"`
+		}
+		if c.AckUDP {
+			if err := c.Request("before", nil); err != nil {
+				t.Fatalf("%s: request: %v", protocol, err)
+			}
+			mu.Lock()
+			for _, m := range msgs {
+				if !m.Request {
+					json.Unmarshal(m.JSON, &out)
+				}
+			}
+			mu.Unlock()
+		} else if err := c.Request("before", &out); err != nil {
+			t.Fatalf("%s: request: %v", protocol, err)
+		}
+		if out.Echo != "after" {
+			t.Errorf("%s: expected rewritten request, got %#v", protocol, out)
+		}
+
+		mu.Lock()
+		if len(msgs) != 2 {
+			t.Errorf("%s: expected 2 messages, got %d", protocol, len(msgs))
+		} else {
+			if m := msgs[0]; !m.Request || m.Protocol != protocol || string(m.JSON) != `"after"` || string(m.Original) != `"before"` || m.Client == nil {
+				t.Errorf("%s: incorrect request message %#v", protocol, m)
+			}
+			if m := msgs[1]; m.Request || m.Protocol != protocol || string(m.JSON) != `{"echo":"after"}` || m.Original != nil {
+				t.Errorf("%s: incorrect response message %#v", protocol, m)
+			}
+		}
+		mu.Unlock()
+
+		c.ResponseTimeout = time.Millisecond * 200
+		if err := c.Request("drop", new(interface{})); err == nil {
+			t.Errorf("%s: expected dropped request to fail", protocol)
+		}
+	}
+}
+
+func TestProxyUDPDefaultMaxMessageSize(t *testing.T) {
+	defer func(v int64) { DefaultMaxResponseSize = v }(DefaultMaxResponseSize)
+	DefaultMaxResponseSize = 16
+
+	reqs := make(chan string, 10)
+	dev := &Server{
+		Handler: transport.HandlerFunc(func(req []byte) ([]byte, error) {
+			reqs <- string(req)
+			return []byte(`{}`), nil
+		}),
+	}
+	if err := dev.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer dev.Close()
+
+	p := &Proxy{Target: Client{Addr: dev.Addr().String()}}
+	if err := p.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer p.Close()
+
+	c := &Client{Addr: p.Addr().String()}
+	for _, tc := range []struct {
+		Request   string
+		Forwarded bool
+	}{
+		{"a much longer request", false},
+		{"short", true},
+	} {
+		if err := c.Request(tc.Request, nil); err != nil {
+			t.Fatalf("%s: request: %v", tc.Request, err)
+		}
+		select {
+		case req := <-reqs:
+			if !tc.Forwarded {
+				t.Errorf("%s: expected request to be dropped, got %s", tc.Request, req)
+			}
+		case <-time.After(time.Millisecond * 250):
+			if tc.Forwarded {
+				t.Errorf("%s: expected request to be forwarded", tc.Request)
+			}
+		}
+	}
+}
+
+func TestProxyUDPClosedFlow(t *testing.T) {
+	dev := &Server{
+		Handler: transport.HandlerFunc(func(req []byte) ([]byte, error) {
+			return req, nil
+		}),
+	}
+	if err := dev.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer dev.Close()
+
+	p := &Proxy{Target: Client{Addr: dev.Addr().String()}}
+	if err := p.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer p.Close()
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: p.Addr().IP, Port: p.Addr().Port})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// simulate a flow closed by the idle timeout after serveUDP got it
+	closed, err := net.Dial("udp", dev.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	closed.Close()
+	p.mu.Lock()
+	p.flows[conn.LocalAddr().String()] = closed
+	p.mu.Unlock()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write(Encrypt([]byte(`{"test":1}`))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("expected reply after reconnecting, got %v", err)
+	}
+	if resp := string(Decrypt(buf[:n])); resp != `{"test":1}` {
+		t.Errorf("unexpected response %q", resp)
+	}
+}
@@ -0,0 +1,234 @@
+package linkie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+var (
+	DefaultServerIdleTimeout  = time.Second * 30
+	DefaultServerWriteTimeout = time.Second * 5
+	DefaultMaxRequestSize     = int64(1 << 16)
+)
+
+// Server implements the device side of the protocol over TCP and UDP. Like
+// devices, it accepts multiple requests per TCP connection, and replies to UDP
+// requests.
+type Server struct {
+	Handler        transport.Handler
+	IdleTimeout    time.Duration // timeout for reading the next request on a TCP connection
+	WriteTimeout   time.Duration // timeout for writing the response
+	MaxRequestSize int64         // maximum request size (if zero, DefaultMaxRequestSize is used)
+
+	mu     sync.Mutex
+	tcp    net.Listener
+	udp    net.PacketConn
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// Listen listens for TCP connections and UDP datagrams on the same address,
+// then serves requests in the background until the server is closed. If the
+// port is zero, an arbitrary one will be chosen.
+func (s *Server) Listen(addr string) error {
+	tcp, udp, err := listen(addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		tcp.Close()
+		udp.Close()
+		return errors.New("server closed")
+	}
+	if s.tcp != nil {
+		tcp.Close()
+		udp.Close()
+		return errors.New("server already listening")
+	}
+	s.tcp, s.udp = tcp, udp
+	s.conns = map[net.Conn]struct{}{}
+
+	s.wg.Add(2)
+	go s.serveTCP(tcp)
+	go s.serveUDP(udp)
+
+	return nil
+}
+
+// Addr returns the address the server is listening on, or nil if it isn't
+// listening.
+func (s *Server) Addr() *net.TCPAddr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr().(*net.TCPAddr)
+}
+
+// Close stops the server, closes open connections, and waits for pending
+// requests to finish.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	if s.tcp != nil {
+		err = s.tcp.Close()
+		if uerr := s.udp.Close(); err == nil {
+			err = uerr
+		}
+		for c := range s.conns {
+			c.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// listen listens for TCP and UDP on the same address. If the port is zero, an
+// arbitrary one free for both will be chosen.
+func listen(addr string) (net.Listener, net.PacketConn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := 0; ; i++ {
+		tcp, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("listen (tcp): %w", err)
+		}
+		udp, err := net.ListenPacket("udp", net.JoinHostPort(host, strconv.Itoa(tcp.Addr().(*net.TCPAddr).Port)))
+		if err != nil {
+			tcp.Close()
+			if port == "0" && i < 10 {
+				continue // the port was only free for tcp
+			}
+			return nil, nil, fmt.Errorf("listen (udp): %w", err)
+		}
+		return tcp, udp, nil
+	}
+}
+
+func (s *Server) serveTCP(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				continue
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var buf bytes.Buffer
+
+		conn.SetReadDeadline(time.Now().Add(timeoutOr(s.IdleTimeout, DefaultServerIdleTimeout)))
+
+		max := s.MaxRequestSize
+		if max <= 0 {
+			max = DefaultMaxRequestSize
+		}
+		if _, err := buf.ReadFrom(NewFrameReader(conn, max)); err != nil {
+			return
+		}
+
+		resp, err := s.Handler.HandleRequest(buf.Bytes())
+		if err != nil {
+			return
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(timeoutOr(s.WriteTimeout, DefaultServerWriteTimeout)))
+
+		if _, err := NewFrameWriter(conn).Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) serveUDP(pc net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				continue
+			}
+			return
+		}
+
+		max := s.MaxRequestSize
+		if max <= 0 {
+			max = DefaultMaxRequestSize
+		}
+		if int64(n) > max {
+			continue
+		}
+
+		req := Decrypt(buf[:n])
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+
+			resp, err := s.Handler.HandleRequest(req)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(Encrypt(resp), addr)
+		}()
+	}
+}
+
+func timeoutOr(timeout, def time.Duration) time.Duration {
+	if timeout <= 0 {
+		return def
+	}
+	return timeout
+}
@@ -0,0 +1,154 @@
+package linkie
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+func TestServer(t *testing.T) {
+	reqs := make(chan string, 10)
+	s := &Server{
+		Handler: transport.HandlerFunc(func(req []byte) ([]byte, error) {
+			reqs <- string(req)
+			return json.Marshal(map[string]json.RawMessage{"echo": req})
+		}),
+	}
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer s.Close()
+
+	c := &Client{Addr: s.Addr().String()}
+
+	t.Run("TCP", func(t *testing.T) {
+		var out struct {
+			Echo struct {
+				Test int `json:"test"`
+			} `json:"echo"`
+		}
+		if err := c.Request(map[string]int{"test": 1}, &out); err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if out.Echo.Test != 1 {
+			t.Errorf("unexpected response %#v", out)
+		}
+		if req := <-reqs; req != `{"test":1}` {
+			t.Errorf("unexpected request %q", req)
+		}
+	})
+
+	t.Run("UDP", func(t *testing.T) {
+		if err := c.Request(map[string]int{"test": 2}, nil); err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		select {
+		case req := <-reqs:
+			if req != `{"test":2}` {
+				t.Errorf("unexpected request %q", req)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request not received")
+		}
+	})
+
+	t.Run("UDPReply", func(t *testing.T) {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: s.Addr().IP, Port: s.Addr().Port})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(Encrypt([]byte(`{"test":3}`))); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if resp := string(Decrypt(buf[:n])); resp != `{"echo":{"test":3}}` {
+			t.Errorf("unexpected response %q", resp)
+		}
+		<-reqs
+	})
+
+	t.Run("MaxRequestSize", func(t *testing.T) {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte{0x00, 0x01, 0x00, 0x01}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if n, err := conn.Read(make([]byte, 1)); err == nil || n != 0 {
+			t.Errorf("expected connection to be closed")
+		} else if errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected connection to be closed, got timeout")
+		}
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		ss := &Session{Client: *c}
+		defer ss.Close()
+		for i := 0; i < 3; i++ {
+			var out struct {
+				Echo int `json:"echo"`
+			}
+			if err := ss.Request(i, &out); err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			if out.Echo != i {
+				t.Errorf("unexpected response %#v", out)
+			}
+			<-reqs
+		}
+	})
+}
+
+func TestServerUDPDefaultMaxRequestSize(t *testing.T) {
+	defer func(v int64) { DefaultMaxRequestSize = v }(DefaultMaxRequestSize)
+	DefaultMaxRequestSize = 16
+
+	s := &Server{
+		Handler: transport.HandlerFunc(func(req []byte) ([]byte, error) {
+			return req, nil
+		}),
+	}
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer s.Close()
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: s.Addr().IP, Port: s.Addr().Port})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1024)
+	for _, tc := range []struct {
+		Request string
+		Reply   bool
+	}{
+		{`{"test":"long request"}`, false},
+		{`{"test":1}`, true},
+	} {
+		conn.SetDeadline(time.Now().Add(time.Millisecond * 250))
+		if _, err := conn.Write(Encrypt([]byte(tc.Request))); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := conn.Read(buf); (err == nil) != tc.Reply {
+			t.Errorf("%s: expected reply %t, got error %v", tc.Request, tc.Reply, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package linkie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+// Session is like Client, but keeps a TCP connection open to the device and
+// reuses it for consecutive requests. Concurrent requests are serialized. If
+// the device closes the connection between requests, it is transparently
+// reopened and the request is sent again.
+//
+// Since the connection must remain in sync, the response is always read, and
+// UDP is never used.
+type Session struct {
+	Client
+
+	once sync.Once
+	sem  chan struct{}
+	conn net.Conn
+}
+
+var _ transport.ContextRequester = (*Session)(nil)
+
+func (s *Session) Request(in, out interface{}) error {
+	return s.RequestContext(context.Background(), in, out)
+}
+
+func (s *Session) RequestContext(ctx context.Context, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		tr := &Trace{Addr: s.addr(), Protocol: "tcp", Start: time.Now()}
+		err = &Error{Op: OpEncode, Addr: tr.Addr, Err: err}
+		s.observe(tr, err)
+		return err
+	}
+
+	if err := s.lock(ctx); err != nil {
+		return &Error{Op: OpDial, Net: "tcp", Addr: s.addr(), Err: err}
+	}
+	defer s.unlock()
+
+	var resp []byte
+	for retry := true; ; retry = false {
+		if resp, err = s.attempt(ctx, b, retry); err != errStale {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(resp, out); err != nil {
+			return &Error{Op: OpDecode, Net: "tcp", Addr: s.addr(), Err: err}
+		}
+	}
+
+	return nil
+}
+
+// errStale is returned by attempt if the request should be sent again on a
+// new connection.
+var errStale = errors.New("stale connection")
+
+// attempt sends req over the current connection, opening one if required. If
+// retry is true and the request failed on a reused connection before any of
+// the response was read, errStale is returned. The session must be locked.
+func (s *Session) attempt(ctx context.Context, req []byte, retry bool) (resp []byte, err error) {
+	tr := &Trace{
+		Addr:     s.addr(),
+		Protocol: "tcp",
+		Reused:   s.conn != nil,
+		Request:  req,
+		Start:    time.Now(),
+	}
+	defer func() {
+		if err == errStale {
+			s.observe(tr, tr.Err) // report the actual error
+		} else {
+			s.observe(tr, err)
+		}
+	}()
+
+	if !tr.Reused {
+		s.conn, err = s.dial(ctx, "tcp")
+		tr.Dial = time.Since(tr.Start)
+		if err != nil {
+			s.conn = nil
+			return nil, &Error{Op: OpDial, Net: "tcp", Addr: tr.Addr, Err: err}
+		}
+	}
+
+	resp, partial, err := s.roundTrip(ctx, s.conn, frame(req), true, tr)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+
+		// if we didn't get any of the response on a reused connection, the
+		// device probably closed it while idle
+		if retry && tr.Reused && !partial && ctx.Err() == nil && !isTimeout(err) {
+			tr.Err = err
+			return nil, errStale
+		}
+	}
+	return resp, err
+}
+
+// Close closes the current connection, if any. The Session can still be used
+// afterwards, in which case a new connection will be opened.
+func (s *Session) Close() error {
+	s.lock(context.Background())
+	defer s.unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Session) lock(ctx context.Context) error {
+	s.once.Do(func() {
+		s.sem = make(chan struct{}, 1)
+	})
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Session) unlock() {
+	<-s.sem
+}
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// Pool manages a Session for each device.
+type Pool struct {
+	Client Client // template for new sessions (IP and Addr are ignored)
+
+	mu sync.Mutex
+	s  map[string]*Session
+}
+
+// Session gets the Session for the device at ip, creating it if required.
+func (p *Pool) Session(ip net.IP) *Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.s == nil {
+		p.s = map[string]*Session{}
+	}
+	k := ip.String()
+	if s, ok := p.s[k]; ok {
+		return s
+	}
+	s := &Session{Client: p.Client}
+	s.IP, s.Addr = ip, ""
+	p.s[k] = s
+	return s
+}
+
+// Close closes all sessions. The Pool can still be used afterwards.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for k, s := range p.s {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(p.s, k)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package linkie
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	for _, drop := range []bool{false, true} {
+		drop := drop
+		var conns int32
+		l := listenTCP(t, func(conn net.Conn) {
+			atomic.AddInt32(&conns, 1)
+			for {
+				var buf bytes.Buffer
+				if _, err := buf.ReadFrom(NewFrameReader(conn, 0)); err != nil {
+					return
+				}
+				if _, err := NewFrameWriter(conn).Write(buf.Bytes()); err != nil {
+					return
+				}
+				if drop {
+					return
+				}
+			}
+		})
+
+		var traces, reused, failed int32
+		s := &Session{Client: *testClient(l)}
+		s.Observer = ObserverFunc(func(tr *Trace) {
+			atomic.AddInt32(&traces, 1)
+			if tr.Reused {
+				atomic.AddInt32(&reused, 1)
+			}
+			if tr.Err != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var out int
+				if err := s.Request(i, &out); err != nil {
+					t.Errorf("drop=%t: request %d: %v", drop, i, err)
+				} else if out != i {
+					t.Errorf("drop=%t: request %d: got response for %d", drop, i, out)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if err := s.Request(-1, nil); err != nil {
+			t.Errorf("drop=%t: request without response: %v", drop, err)
+		}
+
+		if n := atomic.LoadInt32(&conns); drop && n != 11 {
+			t.Errorf("drop=%t: expected 11 connections, got %d", drop, n)
+		} else if !drop && n != 1 {
+			t.Errorf("drop=%t: expected 1 connection, got %d", drop, n)
+		}
+
+		if drop && (traces != 21 || reused != 10 || failed != 10) {
+			t.Errorf("drop=%t: expected 21 traces with 10 reused and failed, got %d (%d, %d)", drop, traces, reused, failed)
+		} else if !drop && (traces != 11 || reused != 10 || failed != 0) {
+			t.Errorf("drop=%t: expected 11 traces with 10 reused, got %d (%d, %d)", drop, traces, reused, failed)
+		}
+
+		s.Close()
+		l.Close()
+	}
+}
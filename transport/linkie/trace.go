@@ -0,0 +1,39 @@
+package linkie
+
+import "time"
+
+// Trace contains information about a single request to a device.
+type Trace struct {
+	Addr     string        // device address
+	Protocol string        // tcp or udp
+	Reused   bool          // whether an existing connection was used (see Session)
+	Attempts int           // number of times the request was sent (see Client.AckUDP)
+	Request  []byte        // plaintext request JSON
+	Response []byte        // plaintext response JSON, if it was read
+	Start    time.Time     // when the request was started
+	Dial     time.Duration // time spent connecting
+	Write    time.Duration // time spent writing the request
+	Read     time.Duration // time spent reading the response
+	Err      error         // the error returned for the request, if any
+}
+
+// Observer is notified after each request. It must not modify the Trace or
+// retain it after returning, and should return quickly since it is called
+// synchronously.
+type Observer interface {
+	ObserveRequest(t *Trace)
+}
+
+// ObserverFunc adapts a function into an Observer.
+type ObserverFunc func(t *Trace)
+
+func (fn ObserverFunc) ObserveRequest(t *Trace) {
+	fn(t)
+}
+
+func (c *Client) observe(t *Trace, err error) {
+	if c.Observer != nil {
+		t.Err = err
+		c.Observer.ObserveRequest(t)
+	}
+}
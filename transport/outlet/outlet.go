@@ -0,0 +1,188 @@
+// Package outlet implements a transport.Requester which scopes commands to
+// individual outlets of power strips (e.g., HS300, KP303, KP400).
+package outlet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/transport"
+	"github.com/pgaskin/kasa/transport/fanout"
+)
+
+// Requester sets context.child_ids on each request so it applies to ChildIDs
+// instead of the whole device. Any existing context fields in the request are
+// preserved.
+type Requester struct {
+	Requester transport.Requester
+	ChildIDs  []string // full child IDs (see ID)
+}
+
+var _ transport.ContextRequester = (*Requester)(nil)
+
+func (r *Requester) Request(in, out interface{}) error {
+	return r.RequestContext(context.Background(), in, out)
+}
+
+func (r *Requester) RequestContext(ctx context.Context, in, out interface{}) error {
+	req, err := scope(in, r.ChildIDs)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	return transport.RequestContext(ctx, r.Requester, req, out)
+}
+
+// ID returns the full child ID for id, which may be a full ID as returned in
+// get_sysinfo.children, or the two-digit suffix used by some firmware.
+func ID(deviceID, id string) string {
+	if strings.HasPrefix(id, deviceID) {
+		return id
+	}
+	return deviceID + id
+}
+
+// Result is the result of a request to a single outlet.
+type Result struct {
+	ChildID  string
+	Response json.RawMessage // the raw response, if it was read
+	Err      error           // transport or API error
+}
+
+// Results contains the results for each outlet, in the same order as the IDs.
+type Results []Result
+
+// Failed returns the results which have an error.
+func (rs Results) Failed() Results {
+	var f Results
+	for _, r := range rs {
+		if r.Err != nil {
+			f = append(f, r)
+		}
+	}
+	return f
+}
+
+// Err returns an error if the request failed for any outlet.
+func (rs Results) Err() error {
+	f := rs.Failed()
+	switch len(f) {
+	case 0:
+		return nil
+	case 1:
+		return f[0].Err
+	default:
+		return fmt.Errorf("%d of %d outlets failed (first error: %w)", len(f), len(rs), f[0].Err)
+	}
+}
+
+// Request sends in to each outlet separately, one at a time, so errors can be
+// attributed to a specific outlet. If read is true, API errors in the
+// response are also checked. If read is false, the response isn't read (which
+// may allow the request to be made over UDP).
+func Request(ctx context.Context, r transport.Requester, childIDs []string, in interface{}, read bool) Results {
+	rs := make([]transport.Requester, len(childIDs))
+	for i, id := range childIDs {
+		rs[i] = &Requester{Requester: r, ChildIDs: []string{id}}
+	}
+
+	// power strips only handle one request at a time anyways
+	fr := (&fanout.Fanout{Concurrency: 1}).Request(ctx, rs, in, read)
+
+	res := make(Results, len(fr))
+	for i, x := range fr {
+		res[i] = Result{
+			ChildID:  childIDs[i],
+			Response: x.Response,
+			Err:      x.Err,
+		}
+		if res[i].Err == nil && x.Response != nil {
+			res[i].Err = checkResponse(x.Response)
+		}
+		if res[i].Err != nil {
+			res[i].Err = fmt.Errorf("outlet %s: %w", childIDs[i], res[i].Err)
+		}
+	}
+	return res
+}
+
+// scope returns in with context.child_ids set.
+func scope(in interface{}, childIDs []string) (json.RawMessage, error) {
+	buf, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, errors.New("request is not an object")
+	}
+
+	ctx := map[string]json.RawMessage{}
+	if c, ok := obj["context"]; ok {
+		if err := json.Unmarshal(c, &ctx); err != nil {
+			return nil, fmt.Errorf("context: %w", err)
+		}
+		if ctx == nil {
+			ctx = map[string]json.RawMessage{}
+		}
+	}
+	if childIDs == nil {
+		childIDs = []string{}
+	}
+	if ctx["child_ids"], err = json.Marshal(childIDs); err != nil {
+		return nil, err
+	}
+	if obj["context"], err = json.Marshal(ctx); err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+// checkResponse returns the first module or method API error in resp, in
+// lexical order.
+func checkResponse(resp json.RawMessage) error {
+	var modules map[string]json.RawMessage
+	if err := json.Unmarshal(resp, &modules); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	for _, mod := range sortedKeys(modules) {
+		var c tpcommand.Checked
+		if err := json.Unmarshal(modules[mod], &c); err != nil {
+			continue // not a module object
+		}
+		if err := c.CheckError(); err != nil {
+			return fmt.Errorf("%s: %w", mod, err)
+		}
+		var methods map[string]json.RawMessage
+		if err := json.Unmarshal(modules[mod], &methods); err != nil {
+			continue
+		}
+		for _, meth := range sortedKeys(methods) {
+			var c tpcommand.Checked
+			if err := json.Unmarshal(methods[meth], &c); err != nil {
+				continue // not a method object
+			}
+			if err := c.CheckError(); err != nil {
+				return fmt.Errorf("%s.%s: %w", mod, meth, err)
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
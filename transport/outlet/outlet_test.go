@@ -0,0 +1,143 @@
+package outlet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/device"
+	"github.com/pgaskin/kasa/tpcommand/smartplug"
+)
+
+// stripRequester is a fake power strip which fails requests for unknown
+// outlets.
+type stripRequester struct {
+	Known    map[string]bool
+	Requests []json.RawMessage
+}
+
+func (s *stripRequester) Request(in, out interface{}) error {
+	buf, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	s.Requests = append(s.Requests, buf)
+
+	var req smartplug.SmartPlugCommand
+	if err := json.Unmarshal(buf, &req); err != nil {
+		return err
+	}
+
+	resp := `{"system":{"set_relay_state":{"err_code":0}}}`
+	if req.Context == nil || req.Context.ChildIDs == nil {
+		return errors.New("missing child_ids")
+	}
+	for _, id := range *req.Context.ChildIDs {
+		if !s.Known[id] {
+			resp = `{"system":{"set_relay_state":{"err_code":-14,"err_msg":"entry not exist"}}}`
+		}
+	}
+	if out != nil {
+		return json.Unmarshal([]byte(resp), out)
+	}
+	return nil
+}
+
+func TestRequester(t *testing.T) {
+	s := &stripRequester{Known: map[string]bool{"DEV00": true, "DEV01": true}}
+	r := &Requester{Requester: s, ChildIDs: []string{"DEV00", "DEV01"}}
+
+	var resp smartplug.SmartPlugCommand
+	if err := r.Request(smartplug.SmartPlugCommand{
+		DeviceCommand: device.DeviceCommand{
+			Context: &device.ContextModule{
+				Source: tpcommand.StrPtr("test"),
+			},
+		},
+		System: &smartplug.SystemModule{
+			SetRelayState: &smartplug.SetRelayStateMethod{
+				State: tpcommand.IntPtr(1),
+			},
+		},
+	}, &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := resp.System.SetRelayState.CheckError(); err != nil {
+		t.Errorf("unexpected api error: %v", err)
+	}
+
+	var req smartplug.SmartPlugCommand
+	if err := json.Unmarshal(s.Requests[0], &req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Context.Source == nil || *req.Context.Source != "test" {
+		t.Errorf("existing context not preserved: %s", s.Requests[0])
+	}
+	if exp := []string{"DEV00", "DEV01"}; !reflect.DeepEqual(*req.Context.ChildIDs, exp) {
+		t.Errorf("expected child ids %q, got %q", exp, *req.Context.ChildIDs)
+	}
+
+	if err := r.Request(42, nil); err == nil {
+		t.Errorf("expected error for non-object request")
+	}
+}
+
+func TestRequest(t *testing.T) {
+	s := &stripRequester{Known: map[string]bool{"DEV00": true, "DEV02": true}}
+
+	res := Request(context.Background(), s, []string{"DEV00", "DEV01", "DEV02"}, smartplug.SmartPlugCommand{
+		System: &smartplug.SystemModule{
+			SetRelayState: &smartplug.SetRelayStateMethod{
+				State: tpcommand.IntPtr(0),
+			},
+		},
+	}, true)
+
+	if len(s.Requests) != 3 {
+		t.Errorf("expected 3 requests, got %d", len(s.Requests))
+	}
+	for i, r := range res {
+		if r.Response == nil {
+			t.Errorf("result %d: expected response", i)
+		}
+	}
+	if f := res.Failed(); len(f) != 1 || f[0].ChildID != "DEV01" {
+		t.Fatalf("expected only DEV01 to fail, got %+v", f)
+	}
+	var terr tpcommand.Error
+	if err := res.Err(); !errors.As(err, &terr) || terr.Code != -14 {
+		t.Errorf("expected api error -14, got %v", err)
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	for _, tc := range []struct {
+		Response string
+		Error    string
+	}{
+		{`{"system":{"get_sysinfo":{"err_code":0}}}`, ""},
+		{`{"system":{"err_code":-1,"err_msg":"module not support"}}`, "system: tp-link api error -1: module not support"},
+		{`{"emeter":{"get_realtime":{"err_code":0}},"count_down":{"get_rules":{"err_code":-2}}}`, "count_down.get_rules: tp-link api error -2"},
+	} {
+		err := checkResponse(json.RawMessage(tc.Response))
+		if tc.Error == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.Response, err)
+			}
+		} else if err == nil || err.Error() != tc.Error {
+			t.Errorf("%s: expected error %q, got %v", tc.Response, tc.Error, err)
+		}
+	}
+}
+
+func TestID(t *testing.T) {
+	if id := ID("DEV", "01"); id != "DEV01" {
+		t.Errorf("expected DEV01, got %s", id)
+	}
+	if id := ID("DEV", "DEV01"); id != "DEV01" {
+		t.Errorf("expected DEV01, got %s", id)
+	}
+}
@@ -0,0 +1,216 @@
+// Package replay implements a transport.Requester which records requests and
+// responses to a cassette, and one which replays them without a device.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+// Interaction is a recorded request.
+type Interaction struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"` // raw response, or nil if it wasn't read
+	Error    string          `json:"error,omitempty"`    // error message, if the request failed
+}
+
+// Cassette is a list of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Load reads a cassette from a file.
+func Load(name string) (*Cassette, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, fmt.Errorf("parse cassette: %w", err)
+	}
+	return &c, nil
+}
+
+// Save writes a cassette to a file.
+func (c *Cassette) Save(name string) error {
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(buf, '\n'), 0666)
+}
+
+// Recorder wraps a Requester, appending each request to Cassette.
+type Recorder struct {
+	Requester transport.Requester
+	Cassette  Cassette
+
+	mu sync.Mutex
+}
+
+var _ transport.ContextRequester = (*Recorder)(nil)
+
+func (r *Recorder) Request(in, out interface{}) error {
+	return r.RequestContext(context.Background(), in, out)
+}
+
+func (r *Recorder) RequestContext(ctx context.Context, in, out interface{}) error {
+	req, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	var (
+		raw  json.RawMessage
+		resp interface{}
+	)
+	if out != nil {
+		resp = &raw
+	}
+	err = transport.RequestContext(ctx, r.Requester, json.RawMessage(req), resp)
+
+	it := Interaction{Request: req}
+	if err != nil {
+		it.Error = err.Error()
+	} else if out != nil {
+		it.Response = raw
+	}
+
+	r.mu.Lock()
+	r.Cassette.Interactions = append(r.Cassette.Interactions, it)
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+	}
+	return nil
+}
+
+// Replayer serves responses from a cassette. Each request is matched against
+// the first unused interaction with an equivalent request (i.e., ignoring
+// whitespace and object key order), so identical requests are replayed in the
+// order they were recorded.
+type Replayer struct {
+	Cassette *Cassette
+
+	mu   sync.Mutex
+	used []bool
+}
+
+var _ transport.Requester = (*Replayer)(nil)
+
+// UnmatchedError is returned by Replayer when no unused interaction matches
+// the request.
+type UnmatchedError struct {
+	Request json.RawMessage
+}
+
+func (err *UnmatchedError) Error() string {
+	return fmt.Sprintf("replay: no recorded interaction matches request %s", err.Request)
+}
+
+// RecordedError is returned by Replayer for interactions recorded with an
+// error.
+type RecordedError struct {
+	Message string
+}
+
+func (err *RecordedError) Error() string {
+	return err.Message
+}
+
+func (r *Replayer) Request(in, out interface{}) error {
+	req, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	key, err := canonical(req)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	it, ok := r.match(key)
+	if !ok {
+		return &UnmatchedError{Request: req}
+	}
+	if it.Error != "" {
+		return &RecordedError{Message: it.Error}
+	}
+	if out != nil {
+		if it.Response == nil {
+			return fmt.Errorf("replay: interaction for request %s was recorded without a response", req)
+		}
+		if err := json.Unmarshal(it.Response, out); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) match(key []byte) (Interaction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Cassette == nil {
+		return Interaction{}, false
+	}
+	if n := len(r.Cassette.Interactions); len(r.used) < n {
+		// interactions may have been appended since the last request
+		r.used = append(r.used, make([]bool, n-len(r.used))...)
+	}
+	for i, it := range r.Cassette.Interactions {
+		if r.used[i] {
+			continue
+		}
+		if k, err := canonical(it.Request); err == nil && bytes.Equal(k, key) {
+			r.used[i] = true
+			return it, true
+		}
+	}
+	return Interaction{}, false
+}
+
+// Unused returns the interactions which haven't been replayed yet.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Cassette == nil {
+		return nil
+	}
+	var its []Interaction
+	for i, it := range r.Cassette.Interactions {
+		if i >= len(r.used) || !r.used[i] {
+			its = append(its, it)
+		}
+	}
+	return its
+}
+
+// canonical re-encodes JSON with sorted object keys and no whitespace.
+func canonical(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after value")
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/pgaskin/kasa/sim"
+	"github.com/pgaskin/kasa/tpcommand"
+	"github.com/pgaskin/kasa/tpcommand/smartbulb"
+)
+
+func TestReplay(t *testing.T) {
+	b := sim.NewBulb(sim.Profiles["KL130"])
+	rec := &Recorder{Requester: b}
+
+	on := smartbulb.SmartBulbCommand{
+		LightingService: &smartbulb.LightingServiceModule{
+			TransitionLightState: &smartbulb.TransitionLightStateMethod{
+				LightState: smartbulb.LightState{
+					OnOff: tpcommand.IntPtr(1),
+				},
+			},
+		},
+	}
+	get := map[string]interface{}{
+		"system": map[string]interface{}{
+			"get_sysinfo": map[string]interface{}{},
+		},
+	}
+
+	var recorded smartbulb.SmartBulbCommand
+	if err := rec.Request(on, nil); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := rec.Request(get, &recorded); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := rec.Request(func() {}, nil); err == nil {
+		t.Fatalf("record: expected error")
+	}
+
+	fn := filepath.Join(t.TempDir(), "cassette.json")
+	if err := rec.Cassette.Save(fn); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	c, err := Load(fn)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(c.Interactions) != 2 {
+		t.Fatalf("expected 2 interactions, got %d", len(c.Interactions))
+	}
+
+	rep := &Replayer{Cassette: c}
+
+	var replayed smartbulb.SmartBulbCommand
+	if err := rep.Request(map[string]interface{}{
+		"system": map[string]interface{}{
+			"get_sysinfo": struct{}{},
+		},
+	}, &replayed); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed.SysInfo == nil || replayed.SysInfo.GetSysInfo == nil || *replayed.SysInfo.GetSysInfo.DeviceID != *recorded.SysInfo.GetSysInfo.DeviceID {
+		t.Errorf("incorrect replayed response %#v", replayed)
+	}
+	if n := len(rep.Unused()); n != 1 {
+		t.Errorf("expected 1 unused interaction, got %d", n)
+	}
+
+	if err := rep.Request(on, nil); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+
+	var uerr *UnmatchedError
+	if err := rep.Request(on, nil); !errors.As(err, &uerr) {
+		t.Errorf("expected unmatched error for repeated request, got %v", err)
+	}
+	if n := len(rep.Unused()); n != 0 {
+		t.Errorf("expected no unused interactions, got %d", n)
+	}
+
+	rep = &Replayer{Cassette: &Cassette{Interactions: []Interaction{{Request: []byte(`{}`), Error: "timeout"}}}}
+
+	var rerr *RecordedError
+	if err := rep.Request(struct{}{}, nil); !errors.As(err, &rerr) || rerr.Message != "timeout" {
+		t.Errorf("expected recorded error, got %v", err)
+	}
+}
+
+func TestReplayAppend(t *testing.T) {
+	c := &Cassette{Interactions: []Interaction{{Request: []byte(`{"a":1}`), Response: []byte(`{"a":1}`)}}}
+	rep := &Replayer{Cassette: c}
+	if err := rep.Request(map[string]int{"a": 1}, nil); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+
+	c.Interactions = append(c.Interactions, Interaction{Request: []byte(`{"b":2}`), Response: []byte(`{"b":2}`)})
+	if n := len(rep.Unused()); n != 1 {
+		t.Errorf("expected 1 unused interaction, got %d", n)
+	}
+
+	var out struct {
+		B int `json:"b"`
+	}
+	if err := rep.Request(map[string]int{"b": 2}, &out); err != nil {
+		t.Fatalf("replay appended interaction: %v", err)
+	}
+	if out.B != 2 {
+		t.Errorf("incorrect replayed response %#v", out)
+	}
+	if n := len(rep.Unused()); n != 0 {
+		t.Errorf("expected no unused interactions, got %d", n)
+	}
+}
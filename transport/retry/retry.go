@@ -0,0 +1,169 @@
+// Package retry implements a transport.Requester which retries failed requests
+// with exponential backoff.
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pgaskin/kasa/transport"
+)
+
+var (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = time.Millisecond * 250
+	DefaultMaxBackoff     = time.Second * 5
+	DefaultMultiplier     = 2.0
+)
+
+type Requester struct {
+	Requester      transport.Requester
+	MaxAttempts    int           // maximum number of attempts (if zero, DefaultMaxAttempts is used)
+	InitialBackoff time.Duration // delay before the first retry (if zero, DefaultInitialBackoff is used)
+	MaxBackoff     time.Duration // maximum delay between retries (if zero, DefaultMaxBackoff is used)
+	Multiplier     float64       // backoff multiplier (if zero, DefaultMultiplier is used)
+	Jitter         float64       // fraction of the backoff to randomize by (from 0 to 1)
+	Seed           int64         // seed for the jitter (if zero, a random seed is used)
+
+	// Retryable checks whether a request which failed with err should be
+	// retried. If nil, Retryable is used.
+	Retryable func(err error, idempotent bool) bool
+
+	once sync.Once
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ transport.ContextRequester = (*Requester)(nil)
+
+type nonIdempotentKey struct{}
+
+// NonIdempotent returns a context which marks requests as non-idempotent,
+// i.e., they will only be retried if they definitely weren't sent.
+func NonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentKey{}, true)
+}
+
+// IsNonIdempotent checks whether NonIdempotent was used on ctx.
+func IsNonIdempotent(ctx context.Context) bool {
+	v, _ := ctx.Value(nonIdempotentKey{}).(bool)
+	return v
+}
+
+func (r *Requester) Request(in, out interface{}) error {
+	return r.RequestContext(context.Background(), in, out)
+}
+
+func (r *Requester) RequestContext(ctx context.Context, in, out interface{}) error {
+	attempts := r.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+
+	retryable := r.Retryable
+	if retryable == nil {
+		retryable = Retryable
+	}
+
+	idempotent := !IsNonIdempotent(ctx)
+	for i := 0; ; i++ {
+		err := transport.RequestContext(ctx, r.Requester, in, out)
+		if err == nil || i+1 >= attempts || ctx.Err() != nil || !retryable(err, idempotent) {
+			return err
+		}
+
+		t := time.NewTimer(r.backoff(i))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
+
+// backoff returns the delay before retry n (zero-indexed).
+func (r *Requester) backoff(n int) time.Duration {
+	initial, max, mult := r.InitialBackoff, r.MaxBackoff, r.Multiplier
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	if mult <= 0 {
+		mult = DefaultMultiplier
+	}
+
+	d := math.Min(float64(initial)*math.Pow(mult, float64(n)), float64(max))
+	if j := math.Min(r.Jitter, 1); j > 0 {
+		r.once.Do(func() {
+			seed := r.Seed
+			if seed == 0 {
+				seed = time.Now().UnixNano()
+			}
+			r.rand = rand.New(rand.NewSource(seed))
+		})
+		r.mu.Lock()
+		d += d * j * (r.rand.Float64()*2 - 1)
+		r.mu.Unlock()
+	}
+	return time.Duration(d)
+}
+
+// Retryable returns true if err is a network error or reports itself as a
+// timeout (e.g., linkie.ErrNoReply). If the request isn't idempotent, only
+// errors which happened before the request could have been sent (i.e., dial
+// errors, or errors with a MayHaveReachedDevice method returning false) are
+// retryable.
+func Retryable(err error, idempotent bool) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var (
+		syntaxErr      *json.SyntaxError
+		unmarshalErr   *json.UnmarshalTypeError
+		marshalerErr   *json.MarshalerError
+		unsupTypeErr   *json.UnsupportedTypeError
+		unsupValueErr  *json.UnsupportedValueError
+		invalidUnmarsh *json.InvalidUnmarshalError
+	)
+	if errors.As(err, &syntaxErr) || errors.As(err, &unmarshalErr) || errors.As(err, &marshalerErr) || errors.As(err, &unsupTypeErr) || errors.As(err, &unsupValueErr) || errors.As(err, &invalidUnmarsh) {
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var sendErr interface{ MayHaveReachedDevice() bool }
+	if errors.As(err, &sendErr) && !sendErr.MayHaveReachedDevice() {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,138 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/kasa/transport/linkie"
+)
+
+type failingRequester struct {
+	Errors []error
+	N      int
+}
+
+func (f *failingRequester) Request(in, out interface{}) error {
+	f.N++
+	if f.N <= len(f.Errors) {
+		return f.Errors[f.N-1]
+	}
+	return nil
+}
+
+type unsentError struct{}
+
+func (unsentError) Error() string              { return "unsent" }
+func (unsentError) MayHaveReachedDevice() bool { return false }
+
+func TestRequester(t *testing.T) {
+	var (
+		errDial    = fmt.Errorf("connect (tcp): %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+		errTimeout = fmt.Errorf("read response: %w", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded})
+		errEOF     = fmt.Errorf("read response: %w", io.ErrUnexpectedEOF)
+		errParse   = fmt.Errorf("parse response: %w", &json.SyntaxError{})
+		errOther   = errors.New("other")
+		errNoReply = &linkie.Error{Op: linkie.OpRead, Net: "udp", Err: linkie.ErrNoReply}
+	)
+	for _, tc := range []struct {
+		Name          string
+		Errors        []error
+		NonIdempotent bool
+		Attempts      int
+		Error         error
+	}{
+		{"Success", nil, false, 1, nil},
+		{"Dial", []error{errDial, errDial}, false, 3, nil},
+		{"Timeout", []error{errTimeout, errEOF}, false, 3, nil},
+		{"TooMany", []error{errTimeout, errTimeout, errTimeout, errTimeout}, false, 3, errTimeout},
+		{"Parse", []error{errParse}, false, 1, errParse},
+		{"Other", []error{errOther}, false, 1, errOther},
+		{"NoReply", []error{errNoReply, errNoReply}, false, 3, nil},
+		{"NonIdempotentDial", []error{errDial}, true, 2, nil},
+		{"NonIdempotentTimeout", []error{errTimeout}, true, 1, errTimeout},
+		{"NonIdempotentNoReply", []error{errNoReply}, true, 1, errNoReply},
+		{"NonIdempotentUnsent", []error{unsentError{}}, true, 2, nil},
+	} {
+		f := &failingRequester{Errors: tc.Errors}
+		r := &Requester{
+			Requester:      f,
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Jitter:         0.5,
+		}
+
+		ctx := context.Background()
+		if tc.NonIdempotent {
+			ctx = NonIdempotent(ctx)
+		}
+
+		if err := r.RequestContext(ctx, nil, nil); err != tc.Error {
+			t.Errorf("%s: expected error %v, got %v", tc.Name, tc.Error, err)
+		}
+		if f.N != tc.Attempts {
+			t.Errorf("%s: expected %d attempts, got %d", tc.Name, tc.Attempts, f.N)
+		}
+	}
+}
+
+func TestRequesterContext(t *testing.T) {
+	f := &failingRequester{Errors: []error{&net.OpError{Op: "dial", Err: errors.New("test")}}}
+	r := &Requester{
+		Requester:      f,
+		InitialBackoff: time.Hour,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if err := r.RequestContext(ctx, nil, nil); err == nil {
+		t.Errorf("expected error")
+	}
+	if f.N != 1 {
+		t.Errorf("expected 1 attempt, got %d", f.N)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &Requester{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second * 5,
+		Multiplier:     2,
+	}
+	for i, exp := range []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5} {
+		if d := r.backoff(i); d != exp {
+			t.Errorf("backoff %d: expected %s, got %s", i, exp, d)
+		}
+	}
+	r.Jitter = 0.1
+	for i := 0; i < 100; i++ {
+		if d := r.backoff(0); d < time.Millisecond*900 || d > time.Millisecond*1100 {
+			t.Errorf("backoff with jitter: %s out of range", d)
+		}
+	}
+}
+
+func TestBackoffSeed(t *testing.T) {
+	jitter := func(seed int64) []time.Duration {
+		r := &Requester{Jitter: 1, Seed: seed}
+		ds := make([]time.Duration, 8)
+		for i := range ds {
+			ds[i] = r.backoff(0)
+		}
+		return ds
+	}
+	if a, b := jitter(1), jitter(1); !reflect.DeepEqual(a, b) {
+		t.Errorf("expected the same jitter for the same seed, got %v and %v", a, b)
+	}
+	if a, b := jitter(0), jitter(0); reflect.DeepEqual(a, b) {
+		t.Errorf("expected different jitter without a seed, got %v", a)
+	}
+}
@@ -1,8 +1,45 @@
 package transport
 
+import "context"
+
 type Requester interface {
 	// Request makes a JSON request. If out is nil, optimizations may be made
 	// since the response is not used. Protocol-level errors (i.e. returned in
 	// the JSON) are not checked.
 	Request(in, out interface{}) error
 }
+
+type ContextRequester interface {
+	Requester
+
+	// RequestContext is like Request, but the context can be used to cancel
+	// the request or set a deadline. Any timeouts configured on the Requester
+	// itself still apply.
+	RequestContext(ctx context.Context, in, out interface{}) error
+}
+
+// RequestContext makes a request using r.RequestContext if r implements
+// ContextRequester. Otherwise, the context is only checked before the request
+// is made.
+func RequestContext(ctx context.Context, r Requester, in, out interface{}) error {
+	if cr, ok := r.(ContextRequester); ok {
+		return cr.RequestContext(ctx, in, out)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.Request(in, out)
+}
+
+type Handler interface {
+	// HandleRequest handles a JSON request, returning the JSON response. If an
+	// error is returned, no response is sent.
+	HandleRequest(req []byte) ([]byte, error)
+}
+
+// HandlerFunc adapts a function into a Handler.
+type HandlerFunc func(req []byte) ([]byte, error)
+
+func (fn HandlerFunc) HandleRequest(req []byte) ([]byte, error) {
+	return fn(req)
+}